@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/mtnmunuklu/bridge/sigma"
+	"github.com/mtnmunuklu/bridge/sigma/evaluator/modifiers"
+)
+
+// Severities of the lint findings. Only errors make the lint command fail.
+const (
+	lintError   = "error"
+	lintWarning = "warning"
+)
+
+// lintLevels and lintStatuses are the values that the level and status of a rule can take.
+var (
+	lintLevels   = map[string]bool{"informational": true, "low": true, "medium": true, "high": true, "critical": true}
+	lintStatuses = map[string]bool{"stable": true, "test": true, "experimental": true, "deprecated": true, "unsupported": true}
+)
+
+// lintUUID matches the UUIDs that rule IDs must be.
+var lintUUID = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// lintFinding is a problem found in a rule file. Line and Column start at 1, and are 0 if the problem has no position.
+type lintFinding struct {
+	Path     string
+	Line     int
+	Column   int
+	Severity string
+	Message  string
+}
+
+// String formats the finding as path:line:column: severity: message.
+func (finding lintFinding) String() string {
+	if finding.Line == 0 {
+		return fmt.Sprintf("%s: %s: %s", finding.Path, finding.Severity, finding.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s: %s", finding.Path, finding.Line, finding.Column, finding.Severity, finding.Message)
+}
+
+// lintFiles checks the rule files and prints the findings, in order of path and position.
+// It returns whether any of the findings is an error.
+func lintFiles(fileContents map[string][]byte) bool {
+	var findings []lintFinding
+	for path, fileContent := range fileContents {
+		switch sigma.InferFileType(fileContent) {
+		case sigma.RuleFile:
+			findings = append(findings, lintFile(path, fileContent)...)
+		case sigma.InvalidFile:
+			findings = append(findings, lintFinding{Path: path, Severity: lintError, Message: "invalid YAML"})
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Path != findings[j].Path {
+			return findings[i].Path < findings[j].Path
+		}
+		if findings[i].Line != findings[j].Line {
+			return findings[i].Line < findings[j].Line
+		}
+		return findings[i].Column < findings[j].Column
+	})
+
+	failed := false
+	for _, finding := range findings {
+		fmt.Println(finding)
+		if finding.Severity == lintError {
+			failed = true
+		}
+	}
+	return failed
+}
+
+// lintFile checks the metadata of each document of the file, and the rules that the documents make up.
+func lintFile(path string, fileContent []byte) []lintFinding {
+	var findings []lintFinding
+	report := func(line, column int, severity string, format string, args ...any) {
+		findings = append(findings, lintFinding{Path: path, Line: line, Column: column, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// The metadata is checked per document, so that the findings point at the document that sets it
+	decoder := yaml.NewDecoder(bytes.NewReader(fileContent))
+	for {
+		var document yaml.Node
+		if err := decoder.Decode(&document); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			report(0, 0, lintError, "%v", err)
+			return findings
+		}
+		if len(document.Content) > 0 {
+			lintMetadata(document.Content[0], report)
+		}
+	}
+
+	// The rules are decoded without checking their conditions, which lintRule reports along with the other problems of the rules
+	rules, err := sigma.DecodeRules(fileContent)
+	var parseError *sigma.ParseError
+	if errors.As(err, &parseError) {
+		message := fmt.Sprintf("condition %q: %s", parseError.Condition, parseError.Message)
+		if parseError.Suggestion != "" {
+			message += " (" + parseError.Suggestion + ")"
+		}
+		report(parseError.Line, parseError.Column, lintError, "%s", message)
+		return findings
+	} else if err != nil {
+		report(0, 0, lintError, "%v", err)
+		return findings
+	}
+	for _, rule := range rules {
+		lintRule(rule, report)
+	}
+	return findings
+}
+
+// lintMetadata checks the format of the ID, dates, level and status set in a document.
+func lintMetadata(document *yaml.Node, report func(line, column int, severity string, format string, args ...any)) {
+	for i := 0; i+1 < len(document.Content); i += 2 {
+		key, value := document.Content[i], document.Content[i+1]
+		switch key.Value {
+		case "id":
+			if !lintUUID.MatchString(value.Value) {
+				report(value.Line, value.Column, lintError, "id %s is not a UUID", value.Value)
+			}
+		case "date", "modified":
+			if _, err := time.Parse("2006-01-02", value.Value); err == nil {
+				continue
+			}
+			if _, err := time.Parse("2006/01/02", value.Value); err == nil {
+				report(value.Line, value.Column, lintWarning, "%s %s should be formatted as YYYY-MM-DD", key.Value, value.Value)
+				continue
+			}
+			report(value.Line, value.Column, lintError, "%s %s is not a date formatted as YYYY-MM-DD", key.Value, value.Value)
+		case "level":
+			if !lintLevels[value.Value] {
+				report(value.Line, value.Column, lintError, "unknown level %s", value.Value)
+			}
+		case "status":
+			if !lintStatuses[value.Value] {
+				report(value.Line, value.Column, lintError, "unknown status %s", value.Value)
+			}
+		}
+	}
+}
+
+// lintRule checks the required fields of the rule, the modifiers of its field matchers,
+// and that its conditions and searches refer to each other.
+func lintRule(rule sigma.Rule, report func(line, column int, severity string, format string, args ...any)) {
+	// Missing fields are reported at the document of the rule
+	line, column := rule.Position()
+	if rule.Title == "" {
+		report(line+1, column+1, lintError, "rule has no title")
+	}
+	if rule.Logsource.Category == "" && rule.Logsource.Product == "" && rule.Logsource.Service == "" {
+		report(line+1, column+1, lintError, "rule %s has no logsource category, product or service", rule.Title)
+	}
+	if len(rule.Detection.Searches) == 0 {
+		report(line+1, column+1, lintError, "rule %s has no searches", rule.Title)
+	}
+	if len(rule.Detection.Conditions) == 0 {
+		report(line+1, column+1, lintError, "rule %s has no condition", rule.Title)
+	}
+
+	// Check that the modifiers are known and the comparator comes last
+	for _, search := range rule.Detection.Searches {
+		for _, eventMatcher := range search.EventMatchers {
+			for _, fieldMatcher := range eventMatcher {
+				fieldModifiers := fieldMatcher.Modifiers
+				if len(fieldModifiers) > 0 && fieldModifiers[len(fieldModifiers)-1] == "all" {
+					fieldModifiers = fieldModifiers[:len(fieldModifiers)-1]
+				}
+				line, column := fieldMatcher.Position()
+				if _, err := modifiers.GetComparator(fieldModifiers...); err != nil {
+					report(line+1, column+1, lintError, "field %s: %v", fieldMatcher.Field, err)
+				}
+
+				// Networks must be valid IPv4 or IPv6 prefixes, unless they are placeholders
+				_, comparator, _ := modifiers.GetModifiers(fieldModifiers...)
+				if comparator == "cidr" {
+					for _, value := range fieldMatcher.Values {
+						value := fmt.Sprint(value)
+						if strings.HasPrefix(value, "%") && strings.HasSuffix(value, "%") {
+							continue
+						}
+						if _, err := netip.ParsePrefix(value); err != nil {
+							report(line+1, column+1, lintError, "field %s: invalid cidr %s", fieldMatcher.Field, value)
+						}
+					}
+				}
+				if comparator == "exists" {
+					for _, value := range fieldMatcher.Values {
+						if _, err := modifiers.ParseExists(value); err != nil {
+							report(line+1, column+1, lintError, "field %s: %v", fieldMatcher.Field, err)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// Check that the identifiers of the conditions exist, and collect the searches they refer to
+	used := make(map[string]bool)
+	for _, condition := range rule.Detection.Conditions {
+		line, column := condition.Position()
+		expressions := []sigma.SearchExpr{condition.Search}
+		if near, ok := condition.Aggregation.(sigma.Near); ok {
+			expressions = append(expressions, near.Condition)
+		}
+		for _, expression := range expressions {
+			for _, problem := range lintSearchExpr(expression, rule.Detection.Searches, used) {
+				report(line+1, column+1, lintError, "%s", problem)
+			}
+		}
+	}
+
+	// Searches that no condition refers to are ignored by the rule
+	for name, search := range rule.Detection.Searches {
+		if !used[name] {
+			line, column := search.Position()
+			report(line+1, column+1, lintWarning, "search %s is not used by any condition", name)
+		}
+	}
+}
+
+// lintSearchExpr marks the searches that the expression refers to as used,
+// and returns the problems with identifiers and patterns that don't refer to any search.
+func lintSearchExpr(search sigma.SearchExpr, searches map[string]sigma.Search, used map[string]bool) []string {
+	var problems []string
+	identifier := func(name string) {
+		if _, ok := searches[name]; !ok {
+			problems = append(problems, fmt.Sprintf("condition refers to undefined search %s", name))
+		}
+		used[name] = true
+	}
+	// "1 of selection" is a common mistake for "1 of selection*"
+	oneOf := func(name string) {
+		if _, ok := searches[name]; !ok {
+			for search := range searches {
+				if strings.HasPrefix(search, name) {
+					problems = append(problems, fmt.Sprintf("condition refers to undefined search %s (did you mean %s* to match the searches starting with %s?)", name, name, name))
+					return
+				}
+			}
+		}
+		identifier(name)
+	}
+	pattern := func(pattern string) {
+		matched := false
+		for name := range searches {
+			if matches, _ := path.Match(pattern, name); matches {
+				used[name] = true
+				matched = true
+			}
+		}
+		if !matched {
+			problems = append(problems, fmt.Sprintf("condition pattern %s doesn't match any search", pattern))
+		}
+	}
+
+	switch s := search.(type) {
+	case sigma.And:
+		for _, node := range s {
+			problems = append(problems, lintSearchExpr(node, searches, used)...)
+		}
+	case sigma.Or:
+		for _, node := range s {
+			problems = append(problems, lintSearchExpr(node, searches, used)...)
+		}
+	case sigma.Not:
+		problems = append(problems, lintSearchExpr(s.Expr, searches, used)...)
+	case sigma.SearchIdentifier:
+		identifier(s.Name)
+	case sigma.OneOfIdentifier:
+		oneOf(s.Ident.Name)
+	case sigma.AllOfIdentifier:
+		oneOf(s.Ident.Name)
+	case sigma.OneOfThem, sigma.AllOfThem:
+		pattern("*")
+	case sigma.OneOfPattern:
+		pattern(s.Pattern)
+	case sigma.AllOfPattern:
+		pattern(s.Pattern)
+	}
+	return problems
+}
@@ -1,17 +1,20 @@
 package main
 
 import (
+	"bufio"
 	"encoding/base64"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/mtnmunuklu/bridge/sigma"
 	"github.com/mtnmunuklu/bridge/sigma/evaluator"
+	"github.com/mtnmunuklu/bridge/sigma/evaluator/backends"
 )
 
 var (
@@ -24,14 +27,34 @@ var (
 	outputPath    string
 	version       bool
 	caseSensitive bool
+	target        string
+	defaultField  string
+	sequenceBy    string
+	dialect       string
+	timestamp     string
+	command       string
+	eventsPath    string
+	savedSearches bool
+	cim           bool
+	templatePath  string
+	filtersPath   string
+	filters       []sigma.Filter
+
+	placeholdersPath string
+	placeholders     map[string][]string
+	unresolved       string
 )
 
 func printUsage() {
 	fmt.Println("Usage: bridge -filepath <path> -config <path> [flags]")
+	fmt.Println("       bridge match -filepath <path> -events <path> [-config <path>] [flags]")
+	fmt.Println("       bridge lint -filepath <path>")
 	fmt.Println("Flags:")
 	flag.PrintDefaults()
 	fmt.Println("Example:")
 	fmt.Println("  bridge -filepath /path/to/file -config /path/to/config")
+	fmt.Println("  bridge match -filepath /path/to/file -events /path/to/events.jsonl")
+	fmt.Println("  bridge lint -filepath /path/to/file")
 }
 
 // Set up the command-line flags
@@ -45,7 +68,28 @@ func init() {
 	flag.StringVar(&outputPath, "output", "", "Output directory for writing files")
 	flag.BoolVar(&version, "version", false, "Show version information")
 	flag.BoolVar(&caseSensitive, "cs", false, "Case sensitive mode")
-	flag.Parse()
+	flag.StringVar(&target, "target", "spl", "Target query language (spl, kql, lucene, eql, aql, logql, sql)")
+	flag.StringVar(&defaultField, "defaultfield", "", "Default field for keyword searches (lucene)")
+	flag.StringVar(&sequenceBy, "sequenceby", "", "Comma-separated fields that the events of near sequences must share (eql)")
+	flag.StringVar(&dialect, "dialect", "sqlite", "SQL dialect (sqlite, postgresql)")
+	flag.StringVar(&timestamp, "timestamp", "", "Timestamp column that aggregations with a timeframe are bucketed by (sql)")
+	flag.BoolVar(&savedSearches, "savedsearches", false, "Output results as a single Splunk savedsearches.conf file (spl)")
+	flag.StringVar(&templatePath, "template", "", "Path to a savedsearches.conf template with default settings, such as action.* (savedsearches)")
+	flag.BoolVar(&cim, "cim", false, "Search CIM data models with tstats where possible (spl)")
+	flag.StringVar(&filtersPath, "filters", "", "Directory of Sigma filters to apply to the rules")
+	flag.StringVar(&placeholdersPath, "placeholders", "", "Path to a YAML or CSV file with the values of the placeholders of the expand modifier")
+	flag.StringVar(&unresolved, "unresolved", "error", "Handling of placeholders without values (error, skip, wildcard)")
+	flag.StringVar(&eventsPath, "events", "", "Path to a JSON lines file of events to match the rules against (match)")
+}
+
+// Parse and check the command-line flags
+func parseFlags() {
+	// Check if a command is given before the flags
+	args := os.Args[1:]
+	if len(args) > 0 && (args[0] == "match" || args[0] == "lint") {
+		command, args = args[0], args[1:]
+	}
+	flag.CommandLine.Parse(args)
 
 	// If the version flag is provided, print version information and exit
 	if version {
@@ -67,12 +111,56 @@ func init() {
 		configPath = flag.Arg(1)
 	}
 
-	// Check if both filecontent and configcontent are provided
-	if (filePath == "" && fileContent == "") || (configPath == "" && configContent == "") {
+	// Check if the events are provided to the match command
+	if command == "match" && eventsPath == "" {
+		fmt.Println("Please provide the events to match with the events flag.")
+		printUsage()
+		os.Exit(1)
+	}
+
+	// Check if both filecontent and configcontent are provided. The config is optional when matching events or linting.
+	if (filePath == "" && fileContent == "") || (configPath == "" && configContent == "" && command == "") {
 		fmt.Println("Please provide either file paths or file contents, and either config path or config content.")
 		printUsage()
 		os.Exit(1)
 	}
+
+	// Check if the target query language is supported
+	if _, ok := backends.Backends[target]; !ok {
+		fmt.Printf("Unsupported target: %s\n", target)
+		printUsage()
+		os.Exit(1)
+	}
+
+	// Check if the saved searches can be written for the target query language
+	if savedSearches && target != "spl" {
+		fmt.Println("The savedsearches output requires the spl target.")
+		printUsage()
+		os.Exit(1)
+	}
+
+	// Check if the CIM data models can be searched for the target query language
+	if cim && target != "spl" {
+		fmt.Println("The cim mode requires the spl target.")
+		printUsage()
+		os.Exit(1)
+	}
+
+	// Check if the handling of unresolved placeholders is supported
+	switch evaluator.UnresolvedPlaceholders(unresolved) {
+	case evaluator.UnresolvedError, evaluator.UnresolvedSkip, evaluator.UnresolvedWildcard:
+	default:
+		fmt.Printf("Unsupported handling of unresolved placeholders: %s\n", unresolved)
+		printUsage()
+		os.Exit(1)
+	}
+
+	// Check if the SQL dialect is supported
+	if backends.SQLDialect(dialect) != backends.SQLite && backends.SQLDialect(dialect) != backends.PostgreSQL {
+		fmt.Printf("Unsupported SQL dialect: %s\n", dialect)
+		printUsage()
+		os.Exit(1)
+	}
 }
 
 func formatSigmaJSONResult(rule sigma.Rule, queries map[int]string) []byte {
@@ -119,6 +207,7 @@ func formatSigmaJSONResult(rule sigma.Rule, queries map[int]string) []byte {
 }
 
 func main() {
+	parseFlags()
 
 	// Read the contents of the file(s) specified by the filepath flag or filecontent flag
 	fileContents := make(map[string][]byte)
@@ -185,6 +274,14 @@ func main() {
 		}
 	}
 
+	// Check the rules instead of converting them, failing if any of them has errors
+	if command == "lint" {
+		if lintFiles(fileContents) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Read the contents of the configuration file or use configcontent
 	var configContents []byte
 	if configPath != "" {
@@ -203,67 +300,409 @@ func main() {
 		configContents = decodedContent
 	}
 
-	for _, fileContent := range fileContents {
-		sigmaRule, err := sigma.ParseRule(fileContent)
+	// Read the Sigma filters that are applied to the rules
+	if filtersPath != "" {
+		filters, err = readFilters(filtersPath)
 		if err != nil {
-			fmt.Println("Error parsing rule:", err)
-			continue
+			fmt.Println("Error reading filters:", err)
+			return
 		}
+	}
 
-		// Parse the configuration file as a Sigma config
-		config, err := sigma.ParseConfig(configContents)
+	// Read the values of the placeholders of the expand modifier
+	if placeholdersPath != "" {
+		placeholders, err = readPlaceholders(placeholdersPath)
 		if err != nil {
-			fmt.Println("Error parsing config:", err)
+			fmt.Println("Error reading placeholders:", err)
+			return
+		}
+	}
+
+	if command == "match" {
+		matchEvents(fileContents, configContents)
+		return
+	}
+
+	// Select the backend for the target query language
+	backend := backends.Backends[target]
+	if lucene, ok := backend.(backends.Lucene); ok && defaultField != "" {
+		lucene.DefaultField = defaultField
+		backend = lucene
+	}
+	if eql, ok := backend.(backends.EQL); ok && sequenceBy != "" {
+		eql.SequenceBy = strings.Split(sequenceBy, ",")
+		backend = eql
+	}
+	if sql, ok := backend.(backends.SQL); ok {
+		sql.Dialect = backends.SQLDialect(dialect)
+		sql.TimestampColumn = timestamp
+		backend = sql
+	}
+
+	// Read the template of the saved searches
+	var template []savedSearchSetting
+	if templatePath != "" {
+		templateContents, err := os.ReadFile(templatePath)
+		if err != nil {
+			fmt.Println("Error reading template file:", err)
+			return
+		}
+		template, err = parseSavedSearchTemplate(templateContents)
+		if err != nil {
+			fmt.Println("Error parsing template:", err)
+			return
+		}
+	}
+	var searches []savedSearch
+
+	// Parse the configuration file as a Sigma config
+	config, err := sigma.ParseConfig(configContents)
+	if err != nil {
+		fmt.Println("Error parsing config:", err)
+		return
+	}
+
+	// Evaluate the Sigma rules against the config using the selected backend
+	options := []evaluator.Option{evaluator.WithConfig(config), evaluator.WithBackend(backend)}
+	options = append(options, placeholderOptions(config)...)
+	if caseSensitive {
+		// Use case sensitive mode
+		options = append(options, evaluator.CaseSensitive)
+	}
+
+	// Collect the rules that correlation rules can refer to
+	var rules []sigma.Rule
+	for _, fileContent := range fileContents {
+		if sigma.InferFileType(fileContent) == sigma.RuleFile {
+			if sigmaRules, err := sigma.ParseRules(fileContent); err == nil {
+				rules = append(rules, sigmaRules...)
+			}
+		}
+	}
+
+	// Convert the correlation rules before the rules they refer to, which only generate queries on their own if the correlation says so.
+	// The rules of a correlation that can't be converted still generate their own queries.
+	type correlationQuery struct {
+		rule  sigma.Rule
+		query string
+	}
+	correlationQueries := make(map[string][]correlationQuery)
+	correlated := make(map[string]bool)
+	for path, fileContent := range fileContents {
+		if sigma.InferFileType(fileContent) != sigma.CorrelationFile {
 			continue
 		}
+		correlations, err := sigma.ParseCorrelations(fileContent, rules...)
+		if err != nil {
+			fmt.Println("Error parsing correlation rule:", sigma.SetFile(err, path))
+			continue
+		}
+		for _, correlation := range correlations {
+			for i, sigmaRule := range correlation.Rules {
+				correlation.Rules[i] = applyFilters(sigmaRule)
+			}
 
-		var rule *evaluator.RuleEvaluator
+			query, err := evaluator.ForCorrelation(correlation, options...).Bridges()
+			if err != nil {
+				fmt.Println("Error converting correlation rule:", err)
+				continue
+			}
+			correlationQueries[path] = append(correlationQueries[path], correlationQuery{correlationRule(correlation), query})
 
-		if caseSensitive {
-			// Evaluate the Sigma rule against the config using case sensitive mode
-			rule = evaluator.ForRule(sigmaRule, evaluator.WithConfig(config), evaluator.CaseSensitive)
-		} else {
-			// Evaluate the Sigma rule against the config
-			rule = evaluator.ForRule(sigmaRule, evaluator.WithConfig(config))
+			if !correlation.Correlation.Generate {
+				for _, sigmaRule := range correlation.Rules {
+					correlated[ruleID(sigmaRule)] = true
+				}
+			}
+		}
+	}
+
+	for path, fileContent := range fileContents {
+		// Each correlation rule is written as a single query
+		if sigma.InferFileType(fileContent) == sigma.CorrelationFile {
+			for _, correlation := range correlationQueries[path] {
+				if savedSearches {
+					searches = append(searches, newSavedSearches(correlation.rule, map[int]string{0: correlation.query}, template)...)
+					continue
+				}
+				writeOutput(correlation.rule, map[int]string{0: correlation.query})
+			}
+			// The rule documents of the correlation file are converted below, like those of any other file
+		}
+		if sigma.InferFileType(fileContent) == sigma.FilterFile {
+			continue
 		}
 
-		result, err := rule.Bridges()
+		// Rule collections produce several rules from a single file
+		sigmaRules, err := sigma.ParseRules(fileContent)
 		if err != nil {
-			fmt.Println("Error converting rule:", err)
+			fmt.Println("Error parsing rule:", sigma.SetFile(err, path))
 			continue
 		}
 
-		var output string
+		for _, sigmaRule := range sigmaRules {
+			if correlated[ruleID(sigmaRule)] {
+				continue
+			}
 
-		// Print the results of the query
-		if outputJSON {
-			jsonResult := formatSigmaJSONResult(sigmaRule, result.QueryResults)
-			output = string(jsonResult)
-		} else {
-			var builder strings.Builder
-			for _, queryResult := range result.QueryResults {
-				builder.WriteString(queryResult + "\n")
+			rule := evaluator.ForRule(applyFilters(sigmaRule), options...)
+
+			result, err := bridgeRule(rule, config)
+			if err != nil {
+				fmt.Println("Error converting rule:", err)
+				continue
+			}
+
+			// The saved searches of all rules are merged into a single file
+			if savedSearches {
+				searches = append(searches, newSavedSearches(sigmaRule, result.QueryResults, template)...)
+				continue
 			}
-			output = builder.String()
+
+			writeOutput(sigmaRule, result.QueryResults)
 		}
+	}
+
+	if savedSearches {
+		output := formatSavedSearches(searches)
 
 		// Check if outputPath is provided
 		if outputPath != "" {
-			// Create the output file path using the Name field from the rule
-			outputFilePath := filepath.Join(outputPath, fmt.Sprintf("%s.json", sigmaRule.Title))
+			outputFilePath := filepath.Join(outputPath, "savedsearches.conf")
 
-			// Write the output string to the output file
-			err := os.WriteFile(outputFilePath, []byte(output), 0644)
+			// Write the merged saved searches to the output file
+			err := os.WriteFile(outputFilePath, output, 0644)
 			if err != nil {
 				fmt.Println("Error writing output to file:", err)
-				continue
+				return
 			}
 
-			fmt.Printf("Output for rule '%s' written to file: %s\n", sigmaRule.Title, outputFilePath)
+			fmt.Printf("Saved searches for %d rule(s) written to file: %s\n", len(searches), outputFilePath)
 		} else {
 			fmt.Printf("%s", output)
 		}
+	}
+}
+
+// writeOutput prints the queries of the rule, or writes them to a file in the output directory.
+func writeOutput(sigmaRule sigma.Rule, queries map[int]string) {
+	var output string
+
+	// Print the results of the query
+	if outputJSON {
+		jsonResult := formatSigmaJSONResult(sigmaRule, queries)
+		output = string(jsonResult)
+	} else {
+		var builder strings.Builder
+		for _, queryResult := range queries {
+			builder.WriteString(queryResult + "\n")
+		}
+		output = builder.String()
+	}
+
+	// Check if outputPath is provided
+	if outputPath != "" {
+		// Create the output file path using the Name field from the rule
+		outputFilePath := filepath.Join(outputPath, fmt.Sprintf("%s.json", sigmaRule.Title))
+
+		// Write the output string to the output file
+		err := os.WriteFile(outputFilePath, []byte(output), 0644)
+		if err != nil {
+			fmt.Println("Error writing output to file:", err)
+			return
+		}
+
+		fmt.Printf("Output for rule '%s' written to file: %s\n", sigmaRule.Title, outputFilePath)
+	} else {
+		fmt.Printf("%s", output)
+	}
+}
+
+// correlationRule returns a rule holding the metadata of the correlation rule, for the output formats.
+func correlationRule(correlation sigma.Correlation) sigma.Rule {
+	return sigma.Rule{
+		Title:       correlation.Title,
+		ID:          correlation.ID,
+		Name:        correlation.Name,
+		Status:      correlation.Status,
+		Description: correlation.Description,
+		Author:      correlation.Author,
+		Level:       correlation.Level,
+		References:  correlation.References,
+		Tags:        correlation.Tags,
+		Detection:   sigma.Detection{Timeframe: correlation.Correlation.Timespan},
+	}
+}
+
+// bridgeRule converts the rule using its backend. In cim mode, rules whose logsource maps to a CIM data model
+// are converted to tstats searches over the data model instead, unless they can't be expressed over it.
+// The placeholders of the rule are expanded into the values defined by the config in either case.
+func bridgeRule(rule *evaluator.RuleEvaluator, config sigma.Config) (evaluator.Result, error) {
+	if cim {
+		if dataModel, ok := backends.CIMDataModels[rule.Logsource.Category]; ok {
+			// The data model's field names replace the field mappings of the config
+			options := []evaluator.Option{evaluator.WithBackend(backends.CIM{DataModel: dataModel})}
+			options = append(options, placeholderOptions(config)...)
+			if caseSensitive {
+				options = append(options, evaluator.CaseSensitive)
+			}
+			if result, err := evaluator.ForRule(rule.Rule, options...).Bridges(); err == nil {
+				return result, nil
+			}
+		}
+	}
+	return rule.Bridges()
+}
+
+// readFilters reads the Sigma filters of the files in the directory. Files that aren't filters are ignored.
+func readFilters(dir string) ([]sigma.Filter, error) {
+	var result []sigma.Filter
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if sigma.InferFileType(content) != sigma.FilterFile {
+			return nil
+		}
+		filter, err := sigma.ParseFilter(content)
+		if err != nil {
+			return fmt.Errorf("error parsing filter %s: %w", path, err)
+		}
+		result = append(result, filter)
+		return nil
+	})
+	return result, err
+}
+
+// applyFilters returns the rule with the conditions of the filters that apply to it.
+func applyFilters(rule sigma.Rule) sigma.Rule {
+	for _, filter := range filters {
+		if filter.AppliesTo(rule) {
+			rule = filter.Apply(rule)
+		}
+	}
+	return rule
+}
+
+// readPlaceholders reads the values of the placeholders from a YAML file, or a CSV file if it has the .csv extension.
+func readPlaceholders(path string) (map[string][]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return sigma.ParsePlaceholdersCSV(content)
+	}
+	return sigma.ParsePlaceholders(content)
+}
+
+// placeholderOptions returns the options that expand the placeholders into the values defined by the configs
+// and the placeholders file, handling placeholders without values as set by the unresolved flag.
+func placeholderOptions(configs ...sigma.Config) []evaluator.Option {
+	values := evaluator.ConfigPlaceholders(configs...)
+	for name, placeholderValues := range placeholders {
+		values[name] = append(values[name], placeholderValues...)
+	}
+	return []evaluator.Option{
+		evaluator.WithPlaceholderExpander(evaluator.PlaceholderExpander(values)),
+		evaluator.WithUnresolvedPlaceholders(evaluator.UnresolvedPlaceholders(unresolved)),
+	}
+}
+
+// matchEvents evaluates the rules against each event of the events file and prints the IDs of the matching rules per event.
+func matchEvents(fileContents map[string][]byte, configContents []byte) {
+	var options []evaluator.Option
+	var configs []sigma.Config
+	if configContents != nil {
+		config, err := sigma.ParseConfig(configContents)
+		if err != nil {
+			fmt.Println("Error parsing config:", err)
+			return
+		}
+		options = append(options, evaluator.WithConfig(config))
+		configs = append(configs, config)
+	}
+	options = append(options, placeholderOptions(configs...)...)
+	if caseSensitive {
+		// Use case sensitive mode
+		options = append(options, evaluator.CaseSensitive)
+	}
 
+	var rules []*evaluator.RuleEvaluator
+	for path, fileContent := range fileContents {
+		if sigma.InferFileType(fileContent) == sigma.FilterFile {
+			continue
+		}
+		sigmaRules, err := sigma.ParseRules(fileContent)
+		if err != nil {
+			fmt.Println("Error parsing rule:", sigma.SetFile(err, path))
+			continue
+		}
+		for _, sigmaRule := range sigmaRules {
+			rules = append(rules, evaluator.ForRule(applyFilters(sigmaRule), options...))
+		}
 	}
+	// Sort the rules so that the matches are printed in a stable order
+	sort.Slice(rules, func(i, j int) bool {
+		return ruleID(rules[i].Rule) < ruleID(rules[j].Rule)
+	})
 
+	events, err := os.Open(eventsPath)
+	if err != nil {
+		fmt.Println("Error reading events file:", err)
+		return
+	}
+	defer events.Close()
+
+	// Rules that fail to evaluate are reported once and skipped afterwards
+	failed := make(map[*evaluator.RuleEvaluator]bool)
+
+	scanner := bufio.NewScanner(events)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var event map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			fmt.Printf("Error decoding event on line %d: %v\n", line, err)
+			continue
+		}
+
+		var matches []string
+		for _, rule := range rules {
+			if failed[rule] {
+				continue
+			}
+			matched, err := rule.Matches(event)
+			if err != nil {
+				fmt.Printf("Error matching rule '%s': %v\n", rule.Title, err)
+				failed[rule] = true
+				continue
+			}
+			if matched {
+				matches = append(matches, ruleID(rule.Rule))
+			}
+		}
+
+		if len(matches) > 0 {
+			fmt.Printf("%d: %s\n", line, strings.Join(matches, ", "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Println("Error reading events file:", err)
+	}
+}
+
+// ruleID returns the ID of the rule, or its title if the rule has no ID.
+func ruleID(rule sigma.Rule) string {
+	if rule.ID != "" {
+		return rule.ID
+	}
+	return rule.Title
 }
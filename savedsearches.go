@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mtnmunuklu/bridge/sigma"
+)
+
+// savedSearchDefaults are the settings of every saved search stanza, unless they are overridden by the template.
+var savedSearchDefaults = []savedSearchSetting{
+	{"enableSched", "1"},
+	{"cron_schedule", "*/15 * * * *"},
+	{"dispatch.earliest_time", "-15m"},
+	{"dispatch.latest_time", "now"},
+	{"counttype", "number of events"},
+	{"relation", "greater than"},
+	{"quantity", "0"},
+	{"alert.track", "1"},
+	{"alert.suppress", "0"},
+}
+
+// savedSearchSeverities maps Sigma rule levels to Splunk alert severities.
+var savedSearchSeverities = map[string]string{
+	"informational": "2",
+	"low":           "3",
+	"medium":        "4",
+	"high":          "5",
+	"critical":      "6",
+}
+
+// savedSearchSetting is a single key-value pair of a saved search stanza.
+type savedSearchSetting struct {
+	Key   string
+	Value string
+}
+
+// savedSearch is a stanza of a savedsearches.conf file.
+type savedSearch struct {
+	Name     string
+	Settings []savedSearchSetting
+}
+
+// parseSavedSearchTemplate parses the key-value pairs of a savedsearches.conf template, such as the action.* settings of the alerts.
+// Comments, empty lines and stanza headers are ignored, so a savedsearches.conf file with a single stanza can be used as a template.
+func parseSavedSearchTemplate(content []byte) ([]savedSearchSetting, error) {
+	var settings []savedSearchSetting
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, "[") {
+			continue
+		}
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value, got %s", line, text)
+		}
+		settings = append(settings, savedSearchSetting{strings.TrimSpace(key), strings.TrimSpace(value)})
+	}
+	return settings, scanner.Err()
+}
+
+// newSavedSearches creates a saved search per query of the rule, named after the rule's title.
+// The settings are made up of the defaults, overridden by the template, and the settings derived from the rule.
+func newSavedSearches(rule sigma.Rule, queries map[int]string, template []savedSearchSetting) []savedSearch {
+	indices := make([]int, 0, len(queries))
+	for index := range queries {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+
+	var searches []savedSearch
+	for _, index := range indices {
+		name := rule.Title
+		if len(indices) > 1 {
+			name = fmt.Sprintf("%s (%d)", rule.Title, index+1)
+		}
+
+		settings := append([]savedSearchSetting{}, savedSearchDefaults...)
+		settings = setSavedSearchSettings(settings, template...)
+		settings = setSavedSearchSettings(settings,
+			savedSearchSetting{"search", queries[index]},
+			savedSearchSetting{"description", strings.TrimSpace(rule.Description)},
+		)
+		// The search runs as often as its timeframe allows, so that consecutive searches leave no events out,
+		// unless the template sets a schedule, which the default time range is kept for
+		if rule.Detection.Timeframe != 0 && !hasSavedSearchSetting(template, "cron_schedule") {
+			schedule, earliest := savedSearchSchedule(rule.Detection.Timeframe)
+			settings = setSavedSearchSettings(settings,
+				savedSearchSetting{"cron_schedule", schedule},
+				savedSearchSetting{"dispatch.earliest_time", "-" + formatSavedSearchTimeframe(earliest)},
+			)
+		}
+		if severity, ok := savedSearchSeverities[strings.ToLower(rule.Level)]; ok {
+			settings = setSavedSearchSettings(settings, savedSearchSetting{"alert.severity", severity})
+		}
+
+		searches = append(searches, savedSearch{Name: name, Settings: settings})
+	}
+	return searches
+}
+
+// savedSearchIntervals are the intervals that a cron schedule can run a search at evenly, in increasing order.
+var savedSearchIntervals = []time.Duration{
+	time.Minute, 2 * time.Minute, 3 * time.Minute, 4 * time.Minute, 5 * time.Minute, 6 * time.Minute, 10 * time.Minute,
+	12 * time.Minute, 15 * time.Minute, 20 * time.Minute, 30 * time.Minute,
+	time.Hour, 2 * time.Hour, 3 * time.Hour, 4 * time.Hour, 6 * time.Hour, 8 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+}
+
+// savedSearchSchedule returns the cron schedule of a search over the timeframe and the time range it searches.
+// The search runs at the longest interval that doesn't exceed the timeframe, so that no events are missed between two searches.
+// Timeframes shorter than a minute are searched every minute over the last minute.
+func savedSearchSchedule(timeframe time.Duration) (string, time.Duration) {
+	interval := savedSearchIntervals[0]
+	for _, candidate := range savedSearchIntervals {
+		if candidate <= timeframe {
+			interval = candidate
+		}
+	}
+
+	earliest := max(timeframe, interval)
+	switch {
+	case interval == time.Minute:
+		return "* * * * *", earliest
+	case interval < time.Hour:
+		return fmt.Sprintf("*/%d * * * *", interval/time.Minute), earliest
+	case interval == time.Hour:
+		return "0 * * * *", earliest
+	case interval < 24*time.Hour:
+		return fmt.Sprintf("0 */%d * * *", interval/time.Hour), earliest
+	default:
+		return "0 0 * * *", earliest
+	}
+}
+
+// hasSavedSearchSetting reports whether the settings have the key.
+func hasSavedSearchSetting(settings []savedSearchSetting, key string) bool {
+	for _, setting := range settings {
+		if setting.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// setSavedSearchSettings replaces the values of existing keys and appends new keys, keeping the order of the settings.
+func setSavedSearchSettings(settings []savedSearchSetting, overrides ...savedSearchSetting) []savedSearchSetting {
+	for _, override := range overrides {
+		replaced := false
+		for i := range settings {
+			if settings[i].Key == override.Key {
+				settings[i].Value = override.Value
+				replaced = true
+			}
+		}
+		if !replaced {
+			settings = append(settings, override)
+		}
+	}
+	return settings
+}
+
+// formatSavedSearches renders the saved searches as a savedsearches.conf file.
+// The searches are sorted by name, and duplicate names are numbered, as stanza names must be unique.
+func formatSavedSearches(searches []savedSearch) []byte {
+	sort.SliceStable(searches, func(i, j int) bool {
+		return searches[i].Name < searches[j].Name
+	})
+
+	var builder strings.Builder
+	names := make(map[string]int)
+	for i, search := range searches {
+		name := search.Name
+		names[name]++
+		if names[name] > 1 {
+			name = fmt.Sprintf("%s (%d)", name, names[name])
+		}
+
+		if i > 0 {
+			builder.WriteString("\n")
+		}
+		// Brackets would end the stanza name early
+		builder.WriteString("[" + strings.NewReplacer("[", "(", "]", ")").Replace(name) + "]\n")
+		for _, setting := range search.Settings {
+			// Multi-line values are continued with a trailing backslash
+			builder.WriteString(strings.TrimSpace(setting.Key+" = "+strings.ReplaceAll(setting.Value, "\n", "\\\n")) + "\n")
+		}
+	}
+	return []byte(builder.String())
+}
+
+// formatSavedSearchTimeframe renders the timeframe as a Splunk relative time modifier, such as 5m or 1h.
+func formatSavedSearchTimeframe(timeframe time.Duration) string {
+	switch {
+	case timeframe%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", timeframe/(24*time.Hour))
+	case timeframe%time.Hour == 0:
+		return fmt.Sprintf("%dh", timeframe/time.Hour)
+	case timeframe%time.Minute == 0:
+		return fmt.Sprintf("%dm", timeframe/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", timeframe/time.Second)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mtnmunuklu/bridge/sigma"
+)
+
+func TestNewSavedSearchesSchedule(t *testing.T) {
+	tests := []struct {
+		name      string
+		timeframe time.Duration
+		template  []savedSearchSetting
+		schedule  string
+		earliest  string
+	}{
+		{"no timeframe", 0, nil, "*/15 * * * *", "-15m"},
+		{"shorter than the default", 5 * time.Minute, nil, "*/5 * * * *", "-5m"},
+		{"shorter than a minute", 30 * time.Second, nil, "* * * * *", "-1m"},
+		// The search runs every 6 minutes over the last 7 minutes, so that no events are missed
+		{"uneven minutes", 7 * time.Minute, nil, "*/6 * * * *", "-7m"},
+		{"hours", 2 * time.Hour, nil, "0 */2 * * *", "-2h"},
+		{"days", 48 * time.Hour, nil, "0 0 * * *", "-2d"},
+		{"template schedule", 5 * time.Minute, []savedSearchSetting{{"cron_schedule", "0 * * * *"}}, "0 * * * *", "-15m"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := sigma.Rule{Title: "Test"}
+			rule.Detection.Timeframe = tt.timeframe
+			searches := newSavedSearches(rule, map[int]string{0: "EventID=4625"}, tt.template)
+			if len(searches) != 1 {
+				t.Fatalf("expected 1 saved search, got %d", len(searches))
+			}
+
+			settings := map[string]string{}
+			for _, setting := range searches[0].Settings {
+				settings[setting.Key] = setting.Value
+			}
+			if settings["cron_schedule"] != tt.schedule {
+				t.Errorf("expected cron_schedule %s, got %s", tt.schedule, settings["cron_schedule"])
+			}
+			if settings["dispatch.earliest_time"] != tt.earliest {
+				t.Errorf("expected dispatch.earliest_time %s, got %s", tt.earliest, settings["dispatch.earliest_time"])
+			}
+		})
+	}
+}
@@ -9,7 +9,7 @@ import (
 
 var (
 	// Define a lexer that matches the different parts of the Sigma condition syntax
-	searchExprLexer = lexer.Must(lexer.Regexp(`(?P<Keyword>(?i)(1 of them)|(all of them)|(1 of)|(all of))` +
+	searchExprLexer = lexer.Must(lexer.Regexp(`(?P<Keyword>(?i)(1 of them)|(all of them)|(1 of)|(all of)|(near\b))` +
 		`|(?P<SearchIdentifierPattern>\*?[a-zA-Z_]+\*[a-zA-Z0-9_*]*)` +
 		`|(?P<SearchIdentifier>[a-zA-Z_][a-zA-Z0-9_]*)` +
 		`|(?P<Operator>(?i)and|or|not|[()])` + // TODO: this never actually matches anything because they get matched as a SearchIdentifier instead. However this isn't currently a problem because we don't parse anything in the Grammar as an Operator (we just use string constants which don't care about Operator vs SearchIdentifier)
@@ -27,12 +27,13 @@ var (
 	)
 )
 
-// Parses the Sigma condition syntax and returns a Condition struct and/or an error
+// Parses the Sigma condition syntax and returns a Condition struct and/or an error.
+// Syntax errors are returned as a *ParseError.
 func ParseCondition(input string) (Condition, error) {
 	root := grammar.Condition{}
 	// Use the searchExprParser to parse the input string into a Condition struct
 	if err := searchExprParser.ParseString(input, &root); err != nil {
-		return Condition{}, err
+		return Condition{}, newParseError(input, err)
 	}
 
 	// Convert the parsed search and aggregation expressions into an abstract syntax tree (AST)
@@ -45,6 +46,15 @@ func ParseCondition(input string) (Condition, error) {
 		return Condition{}, err
 	}
 
+	// A near condition is an aggregation over the events that match its search expression
+	if root.Near != nil {
+		near, err := searchToAST(*root.Near)
+		if err != nil {
+			return Condition{}, err
+		}
+		aggregation = Near{Condition: near}
+	}
+
 	// Return a new Condition struct that contains the ASTs for the search and aggregation expressions
 	return Condition{
 		Search:      search,
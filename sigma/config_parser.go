@@ -11,8 +11,22 @@ type Config struct {
 	FieldMappings map[string]FieldMapping
 	Logsources    map[string]LogsourceMapping
 	// TODO: LogsourceMerging option
-	DefaultIndex string                   // Defines a default index if no logsources match
-	Placeholders map[string][]interface{} // Defines values for placeholders that might appear in Sigma rules
+	DefaultIndex       string                       // Defines a default index if no logsources match
+	Placeholders       map[string][]interface{}     // Defines values for placeholders that might appear in Sigma rules
+	PlaceholderLookups map[string]PlaceholderLookup // Defines lookup tables that hold the values of placeholders, for backends that can search them
+}
+
+// Strategies for searching the lookup table of a placeholder
+const (
+	LookupSubsearch = "subsearch" // The values of the table are searched with a subsearch
+	LookupCommand   = "lookup"    // The events are joined with the table, and filtered on the rows they were joined with
+)
+
+// PlaceholderLookup defines the lookup table that holds the values of a placeholder, instead of listing the values in the config
+type PlaceholderLookup struct {
+	Lookup   string // The name of the lookup table, e.g. admins_workstations.csv
+	Field    string // The column of the table that holds the values, if it is named differently from the event field
+	Strategy string // How the table is searched, LookupSubsearch (the default) or LookupCommand
 }
 
 // FieldMapping is a struct that defines the target fields to be matched in Sigma rules
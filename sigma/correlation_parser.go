@@ -0,0 +1,207 @@
+package sigma
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Correlation is a Sigma correlation rule, which correlates the events matched by other rules
+type Correlation struct {
+	// Required fields
+	Title       string               // The title of the correlation rule
+	Correlation CorrelationDetection // The correlation logic of the rule
+
+	// Optional fields
+	ID          string   `yaml:",omitempty" json:",omitempty"` // The unique ID of the correlation rule
+	Name        string   `yaml:",omitempty" json:",omitempty"` // The name that other correlation rules can refer to this rule by
+	Status      string   `yaml:",omitempty" json:",omitempty"` // The status of the correlation rule (e.g. "test", "stable")
+	Description string   `yaml:",omitempty" json:",omitempty"` // A brief description of the correlation rule
+	Author      string   `yaml:",omitempty" json:",omitempty"` // The author of the correlation rule
+	Level       string   `yaml:",omitempty" json:",omitempty"` // The severity level of the correlation rule
+	References  []string `yaml:",omitempty" json:",omitempty"` // References related to the correlation rule
+	Tags        []string `yaml:",omitempty" json:",omitempty"` // Tags that can be used to organize the rules
+
+	// The rules referenced by the correlation, in the order of Correlation.Rules
+	Rules []Rule `yaml:"-" json:"-"`
+
+	// Any non-standard fields will end up in here
+	AdditionalFields map[string]interface{} `yaml:",inline,omitempty" json:",inline,omitempty"` // Any additional fields in the YAML document
+}
+
+// CorrelationType is the type of a correlation rule
+type CorrelationType string
+
+// Supported correlation types
+const (
+	EventCount      CorrelationType = "event_count"      // Counts the events matched by the rules
+	ValueCount      CorrelationType = "value_count"      // Counts the distinct values of a field in the events matched by the rules
+	Temporal        CorrelationType = "temporal"         // All rules match within the timespan, in any order
+	TemporalOrdered CorrelationType = "temporal_ordered" // All rules match within the timespan, in the order they are listed
+)
+
+// CorrelationDetection defines how the events of the referenced rules are correlated
+type CorrelationDetection struct {
+	Type      CorrelationType      // The type of the correlation
+	Rules     []string             // The IDs or names of the correlated rules
+	GroupBy   []string             `yaml:"group-by,omitempty" json:"group-by,omitempty"` // The fields the events are grouped by
+	Timespan  time.Duration        `yaml:",omitempty" json:",omitempty"`                 // The time window the events must occur in
+	Condition CorrelationCondition `yaml:",omitempty" json:",omitempty"`                 // The condition on the number of events or values
+	Generate  bool                 `yaml:",omitempty" json:",omitempty"`                 // Whether the referenced rules also generate queries on their own
+}
+
+// UnmarshalYAML decodes the correlation, parsing the Sigma timespan notation (e.g. 5m, 1h or 1d)
+func (c *CorrelationDetection) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("invalid correlation (line %d). Expected a map", node.Line)
+	}
+
+	// Decode everything but the timespan with the default decoder
+	type plain CorrelationDetection
+	rest := *node
+	rest.Content = nil
+	var timespan *yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "timespan" {
+			timespan = node.Content[i+1]
+			continue
+		}
+		rest.Content = append(rest.Content, node.Content[i], node.Content[i+1])
+	}
+	if err := rest.Decode((*plain)(c)); err != nil {
+		return err
+	}
+
+	if timespan != nil {
+		duration, err := parseTimespan(timespan.Value)
+		if err != nil {
+			return fmt.Errorf("invalid timespan (line %d): %w", timespan.Line, err)
+		}
+		c.Timespan = duration
+	}
+	return nil
+}
+
+// CorrelationCondition is the condition that the number of events or values has to meet
+type CorrelationCondition struct {
+	Op        ComparisonOp // The comparison operator
+	Threshold float64      // The value the number of events or values is compared to
+	Field     string       // The field whose distinct values are counted, for value_count correlations
+}
+
+// correlationOperators maps the operators of a correlation condition to comparison operators
+var correlationOperators = map[string]ComparisonOp{
+	"gt":  GreaterThan,
+	"gte": GreaterThanEqual,
+	"lt":  LessThan,
+	"lte": LessThanEqual,
+	"eq":  Equal,
+	"neq": NotEqual,
+}
+
+// UnmarshalYAML decodes a condition such as {gte: 10, field: User}
+func (c *CorrelationCondition) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("invalid correlation condition (line %d). Expected a map", node.Line)
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Value == "field" {
+			c.Field = value.Value
+			continue
+		}
+
+		op, ok := correlationOperators[key.Value]
+		if !ok {
+			return fmt.Errorf("unknown correlation condition operator %s (line %d)", key.Value, key.Line)
+		}
+		threshold, err := strconv.ParseFloat(value.Value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid correlation condition threshold %s (line %d)", value.Value, value.Line)
+		}
+		c.Op, c.Threshold = op, threshold
+	}
+	return nil
+}
+
+// parseTimespan parses a Sigma timespan, which may also be given in days (e.g. 1d)
+func parseTimespan(timespan string) (time.Duration, error) {
+	timespan = strings.TrimSpace(timespan)
+	if days, ok := strings.CutSuffix(timespan, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number of days %s", days)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(timespan)
+}
+
+// ParseCorrelations reads the documents of a multi-document YAML input and returns the correlation rules in it.
+// The rules referenced by each correlation are resolved by their ID or name, among the rule documents of the input
+// and the given rules from other files.
+func ParseCorrelations(input []byte, rules ...Rule) ([]Correlation, error) {
+	var correlations []Correlation
+	decoder := yaml.NewDecoder(bytes.NewReader(input))
+	for {
+		var document yaml.Node
+		if err := decoder.Decode(&document); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		var fileType FileType
+		if err := document.Decode(&fileType); err != nil {
+			return nil, err
+		}
+
+		switch fileType {
+		case CorrelationFile:
+			correlation := Correlation{}
+			if err := document.Decode(&correlation); err != nil {
+				return nil, err
+			}
+			correlations = append(correlations, correlation)
+		case RuleFile:
+			rule := Rule{}
+			if err := document.Decode(&rule); err != nil {
+				return nil, err
+			}
+			if err := rule.Detection.checkOneOf(); err != nil {
+				return nil, err
+			}
+			rule.node = &document
+			rules = append(rules, rule)
+		}
+	}
+
+	// Resolve the referenced rules
+	for i, correlation := range correlations {
+		for _, reference := range correlation.Correlation.Rules {
+			rule, ok := findRule(reference, rules)
+			if !ok {
+				return nil, fmt.Errorf("correlation %s references unknown rule %s", correlation.Title, reference)
+			}
+			correlations[i].Rules = append(correlations[i].Rules, rule)
+		}
+	}
+	return correlations, nil
+}
+
+// findRule returns the rule with the given ID or name
+func findRule(reference string, rules []Rule) (Rule, bool) {
+	for _, rule := range rules {
+		if rule.ID == reference || (rule.Name != "" && rule.Name == reference) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
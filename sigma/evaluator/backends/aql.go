@@ -0,0 +1,193 @@
+package backends
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mtnmunuklu/bridge/sigma"
+)
+
+// AQL renders Sigma rules as QRadar Ariel Query Language statements.
+// The indexes of the config's logsource mappings are used as log source type names.
+type AQL struct{}
+
+// And joins the expressions with the AND operator.
+func (AQL) And(exprs []string) (string, error) {
+	return strings.Join(exprs, " AND "), nil
+}
+
+// Or joins the expressions with the OR operator.
+func (AQL) Or(exprs []string) (string, error) {
+	return strings.Join(exprs, " OR "), nil
+}
+
+// Not negates the expression with the NOT operator.
+func (AQL) Not(expr string) (string, error) {
+	return "NOT " + expr, nil
+}
+
+// Group wraps the expression in parentheses.
+func (AQL) Group(expr string) string {
+	return "(" + expr + ")"
+}
+
+// Keyword searches for the value anywhere in the payload of the event.
+func (AQL) Keyword(value string) (string, error) {
+	return "UTF8(payload) ILIKE " + aqlString(wildcardPattern(withComparator(parseValue(value), "contains"), "%", "_", sqlEscapeLike)) + " ESCAPE '\\'", nil
+}
+
+// FieldMatch renders the comparison using ILIKE for case-insensitive and wildcard matches, and the AQL functions for the other comparators.
+func (AQL) FieldMatch(match FieldMatch) (string, error) {
+	field := aqlField(match.Field)
+
+	switch match.Comparator {
+	case "", "contains", "startswith", "endswith":
+		if match.Comparator == "" && match.Value == "null" {
+			return field + " IS NULL", nil
+		}
+
+		tokens := withComparator(parseValue(match.Value), match.Comparator)
+		literal, leading, trailing, ok := simpleValue(tokens)
+		exact := ok && !leading && !trailing
+		switch {
+		case exact && match.Comparator == "" && isNumber(literal):
+			return field + " = " + literal, nil
+		case exact && match.CaseSensitive:
+			return field + " = " + aqlString(literal), nil
+		case match.CaseSensitive:
+			return field + " LIKE " + aqlString(wildcardPattern(tokens, "%", "_", sqlEscapeLike)) + " ESCAPE '\\'", nil
+		default:
+			return field + " ILIKE " + aqlString(wildcardPattern(tokens, "%", "_", sqlEscapeLike)) + " ESCAPE '\\'", nil
+		}
+
+	case "re":
+		return field + " MATCHES " + aqlString(match.Value), nil
+
+	case "exists":
+		if match.Value == "true" {
+			return field + " IS NOT NULL", nil
+		}
+		return "(" + field + " IS NULL)", nil
+
+	case "cidr":
+		return "INCIDR(" + aqlString(match.Value) + ", " + field + ")", nil
+
+	case "gt", "gte", "lt", "lte":
+		if !isNumber(match.Value) {
+			return "", fmt.Errorf("comparator %s expects a number, got %s", match.Comparator, match.Value)
+		}
+		return field + " " + comparisonOperators[match.Comparator] + " " + match.Value, nil
+
+	default:
+		return "", fmt.Errorf("comparator %s is not supported by the aql backend", match.Comparator)
+	}
+}
+
+// Aggregation renders the aggregation as the select list of the grouped field and the aggregated value,
+// and the GROUP BY and HAVING clauses.
+func (AQL) Aggregation(aggregation sigma.Comparison, timeframe time.Duration) (string, error) {
+	var function, groupedBy string
+	switch agg := aggregation.Func.(type) {
+	case sigma.Count:
+		function, groupedBy = "COUNT(*)", agg.GroupedBy
+		if agg.Field != "" {
+			// Counting a field counts its distinct values
+			function = "UNIQUECOUNT(" + aqlField(agg.Field) + ")"
+		}
+	case sigma.Average:
+		function, groupedBy = "AVG("+aqlField(agg.Field)+")", agg.GroupedBy
+	case sigma.Sum:
+		function, groupedBy = "SUM("+aqlField(agg.Field)+")", agg.GroupedBy
+	case sigma.Min:
+		function, groupedBy = "MIN("+aqlField(agg.Field)+")", agg.GroupedBy
+	case sigma.Max:
+		function, groupedBy = "MAX("+aqlField(agg.Field)+")", agg.GroupedBy
+	default:
+		return "", fmt.Errorf("unsupported aggregation function")
+	}
+
+	selectList := function + " AS value"
+	var clauses string
+	if groupedBy != "" {
+		selectList = aqlField(groupedBy) + ", " + selectList
+		clauses = "GROUP BY " + aqlField(groupedBy) + " "
+	}
+	operator := string(aggregation.Op)
+	if aggregation.Op == sigma.NotEqual {
+		operator = "<>"
+	}
+	clauses += "HAVING " + function + " " + operator + " " + strconv.FormatFloat(aggregation.Threshold, 'f', -1, 64)
+
+	return selectList + sqlAggregationSeparator + clauses, nil
+}
+
+// Query renders a SELECT statement over the events, filtered by the log source types of the logsource and the search.
+// If the rule has a timeframe, the statement is limited to the last timeframe.
+func (AQL) Query(query Query) (string, error) {
+	if len(query.Near) > 0 {
+		return "", fmt.Errorf("near is not supported by the aql backend")
+	}
+
+	var filters []string
+	if len(query.Indexes) > 0 {
+		logsources := make([]string, len(query.Indexes))
+		for i, index := range query.Indexes {
+			logsources[i] = "LOGSOURCETYPENAME(devicetype) = " + aqlString(index)
+		}
+		filter := strings.Join(logsources, " OR ")
+		if len(logsources) > 1 {
+			filter = "(" + filter + ")"
+		}
+		filters = append(filters, filter)
+	}
+	if query.Search != "" {
+		filters = append(filters, "("+query.Search+")")
+	}
+
+	selectList, clauses := "*", ""
+	if query.Aggregation != "" {
+		selectList, clauses, _ = strings.Cut(query.Aggregation, sqlAggregationSeparator)
+	}
+
+	result := "SELECT " + selectList + " FROM events"
+	if len(filters) > 0 {
+		result += " WHERE " + strings.Join(filters, " AND ")
+	}
+	if clauses != "" {
+		result += " " + clauses
+	}
+	if query.Timeframe != 0 {
+		result += " " + aqlTimeframe(query.Timeframe)
+	}
+	return result, nil
+}
+
+// aqlField quotes a property name if it isn't a plain identifier.
+func aqlField(field string) string {
+	for _, r := range field {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return "\"" + strings.ReplaceAll(field, "\"", "\"\"") + "\""
+		}
+	}
+	return field
+}
+
+// aqlString quotes a value as an AQL string literal.
+func aqlString(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// aqlTimeframe renders the timeframe as a LAST clause, rounded up to whole minutes.
+func aqlTimeframe(timeframe time.Duration) string {
+	minutes := int64((timeframe + time.Minute - 1) / time.Minute)
+	switch {
+	case minutes%(24*60) == 0:
+		return fmt.Sprintf("LAST %d DAYS", minutes/(24*60))
+	case minutes%60 == 0:
+		return fmt.Sprintf("LAST %d HOURS", minutes/60)
+	default:
+		return fmt.Sprintf("LAST %d MINUTES", minutes)
+	}
+}
@@ -0,0 +1,114 @@
+package backends
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mtnmunuklu/bridge/sigma"
+)
+
+// Backend renders the parts of a Sigma rule into the syntax of a target query language.
+// The evaluator walks the rule's AST and calls the backend for every node, modifier, keyword, aggregation and logsource,
+// so that a new query language can be supported without touching the Sigma AST code.
+type Backend interface {
+	// And joins expressions that must all match. A single expression is returned unchanged.
+	And(exprs []string) (string, error)
+	// Or joins expressions of which at least one must match. A single expression is returned unchanged.
+	Or(exprs []string) (string, error)
+	// Not negates an expression.
+	Not(expr string) (string, error)
+	// Group wraps a compound expression so that it keeps its precedence when it is nested in another expression.
+	Group(expr string) string
+
+	// Keyword renders a search for a value anywhere in the event.
+	Keyword(value string) (string, error)
+	// FieldMatch renders the comparison of a single field against a single value.
+	FieldMatch(match FieldMatch) (string, error)
+
+	// Aggregation renders the aggregation part of a condition.
+	// The fields of the aggregation function have already been mapped to the event field names.
+	Aggregation(aggregation sigma.Comparison, timeframe time.Duration) (string, error)
+
+	// Query assembles the rendered search expression, the aggregation and the logsource into the final query.
+	Query(query Query) (string, error)
+}
+
+// NegationPusher is implemented by backends whose query language can't negate arbitrary expressions.
+// For these backends, the evaluator never calls Not. Instead, it pushes negations down to the keywords and field matches,
+// swapping the And and Or operations on the way.
+type NegationPusher interface {
+	// NotKeyword renders a search for events that don't contain the value.
+	NotKeyword(value string) (string, error)
+	// NotFieldMatch renders the negation of the comparison of a single field against a single value.
+	NotFieldMatch(match FieldMatch) (string, error)
+}
+
+// Correlator is implemented by backends that can render Sigma correlation rules.
+type Correlator interface {
+	// Correlation renders a single query that correlates the events matched by the queries of the referenced rules.
+	Correlation(correlation Correlation) (string, error)
+}
+
+// Filterer is implemented by backends that can't render some field matches, such as regular expressions, as part of a search.
+// Their FieldMatch returns ErrFilterRequired for these matches, and the evaluator renders the rule with the filter backend instead,
+// which renders the conditions as filters on the events rather than searches.
+type Filterer interface {
+	// Filter returns the backend that renders the conditions as filters, or an error if the conditions can't be rendered as filters.
+	Filter() (Backend, error)
+}
+
+// LookupMatcher is implemented by backends that can match a field against the values of a lookup table,
+// for placeholders that the config maps to a lookup table. For other backends, the placeholders are expanded into their values.
+type LookupMatcher interface {
+	// LookupMatch renders a search for events whose field has any of the values of the lookup table.
+	LookupMatch(lookup Lookup) (string, error)
+}
+
+// ErrFilterRequired is returned by the FieldMatch method of a Filterer for field matches that can only be rendered as filters.
+var ErrFilterRequired = errors.New("the field match can only be rendered as a filter")
+
+// FieldMatch describes the comparison of a single event field against a single expected value.
+type FieldMatch struct {
+	Field         string // The event field name, after field mappings have been applied
+	Comparator    string // The comparator modifier (e.g. "contains"), empty for the default equality comparison
+	Value         string // The expected value, after value modifiers have been applied
+	CaseSensitive bool   // Whether the comparison should be case sensitive
+}
+
+// Lookup describes the match of a single event field against the values of a lookup table.
+type Lookup struct {
+	Field                   string // The event field name, after field mappings have been applied
+	sigma.PlaceholderLookup        // The lookup table of the placeholder
+}
+
+// Query holds the rendered parts of a single condition of a Sigma rule.
+type Query struct {
+	Search      string          // The rendered search expression
+	Aggregation string          // The rendered aggregation, empty if the condition has no aggregation
+	Logsource   sigma.Logsource // The logsource of the rule, after any config rewrites have been applied
+	Indexes     []string        // The indexes that the rule should be applied to, computed from the config
+	Near        []string        // The rendered searches that have to match other events near the search, for near aggregations
+	Timeframe   time.Duration   // The timeframe of the rule's detection, zero if there is none
+	Lookups     []Lookup        // The lookup tables that the rule's field matches refer to, for backends that have to join them with the events
+}
+
+// Correlation holds the rendered parts of a Sigma correlation rule.
+type Correlation struct {
+	Type      sigma.CorrelationType      // The type of the correlation
+	Rules     []string                   // The IDs or names of the referenced rules
+	Queries   []string                   // The rendered queries of the referenced rules, in the order of Rules
+	GroupBy   []string                   // The fields the events are grouped by, after field mappings have been applied
+	Timespan  time.Duration              // The time window the events must occur in, zero if there is none
+	Condition sigma.CorrelationCondition // The condition on the number of events or values, with its field mapped
+}
+
+// Backends is the list of available backends, by the name used to select them.
+var Backends = map[string]Backend{
+	"spl":    SPL{},
+	"kql":    KQL{},
+	"lucene": Lucene{},
+	"eql":    EQL{},
+	"aql":    AQL{},
+	"logql":  LogQL{},
+	"sql":    SQL{},
+}
@@ -0,0 +1,181 @@
+package backends
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/mtnmunuklu/bridge/sigma"
+)
+
+// CIMDataModel is a dataset of a Splunk Common Information Model data model that Sigma rules can be searched in with tstats.
+type CIMDataModel struct {
+	Name      string            // The name of the data model and dataset, e.g. Endpoint.Processes
+	Dataset   string            // The name of the dataset that prefixes the field names, e.g. Processes
+	Fields    map[string]string // A mapping from Sigma field names to the field names of the dataset
+	GroupedBy []string          // The fields of the dataset that the results are split by
+}
+
+// CIMDataModels maps Sigma logsource categories to the CIM data models holding their events.
+var CIMDataModels = map[string]CIMDataModel{
+	"process_creation": {
+		Name:    "Endpoint.Processes",
+		Dataset: "Processes",
+		Fields: map[string]string{
+			"Image":             "process_path",
+			"CommandLine":       "process",
+			"OriginalFileName":  "original_file_name",
+			"CurrentDirectory":  "process_current_directory",
+			"IntegrityLevel":    "process_integrity_level",
+			"Hashes":            "process_hash",
+			"ProcessId":         "process_id",
+			"ProcessGuid":       "process_guid",
+			"ParentImage":       "parent_process_path",
+			"ParentCommandLine": "parent_process",
+			"ParentProcessId":   "parent_process_id",
+			"ParentProcessGuid": "parent_process_guid",
+			"User":              "user",
+			"Computer":          "dest",
+		},
+		GroupedBy: []string{"dest", "user", "parent_process", "process"},
+	},
+	"network_connection": {
+		Name:    "Network_Traffic.All_Traffic",
+		Dataset: "All_Traffic",
+		Fields: map[string]string{
+			"DestinationIp":       "dest_ip",
+			"DestinationPort":     "dest_port",
+			"DestinationHostname": "dest",
+			"SourceIp":            "src_ip",
+			"SourcePort":          "src_port",
+			"SourceHostname":      "src",
+			"Protocol":            "transport",
+			"Image":               "app",
+			"User":                "user",
+		},
+		GroupedBy: []string{"src", "dest", "dest_port", "app"},
+	},
+	"file_event": {
+		Name:    "Endpoint.Filesystem",
+		Dataset: "Filesystem",
+		Fields: map[string]string{
+			"TargetFilename": "file_path",
+			"Image":          "process_path",
+			"ProcessGuid":    "process_guid",
+			"User":           "user",
+			"Computer":       "dest",
+		},
+		GroupedBy: []string{"dest", "user", "file_path"},
+	},
+	"registry_event": {
+		Name:    "Endpoint.Registry",
+		Dataset: "Registry",
+		Fields: map[string]string{
+			"TargetObject": "registry_path",
+			"Details":      "registry_value_data",
+			"EventType":    "action",
+			"Image":        "process_path",
+			"ProcessGuid":  "process_guid",
+			"User":         "user",
+			"Computer":     "dest",
+		},
+		GroupedBy: []string{"dest", "user", "registry_path"},
+	},
+	"dns_query": {
+		Name:    "Network_Resolution.DNS",
+		Dataset: "DNS",
+		Fields: map[string]string{
+			"QueryName":    "query",
+			"QueryResults": "answer",
+			"Computer":     "src",
+		},
+		GroupedBy: []string{"src", "query"},
+	},
+}
+
+// CIM renders Sigma rules as tstats searches over an accelerated CIM data model.
+// Field names are rewritten to the data model's field names. Rules that can't be expressed
+// over the data model, because they use fields it lacks, keywords or aggregations, fail to render,
+// so that the caller can fall back to a raw SPL search.
+type CIM struct {
+	SPL
+	DataModel CIMDataModel // The data model that the rule is searched in
+}
+
+// Keyword returns an error, tstats can only search the fields of the data model.
+func (CIM) Keyword(value string) (string, error) {
+	return "", fmt.Errorf("keyword searches are not supported by data models")
+}
+
+// FieldMatch renders the comparison on the data model's field that the Sigma field maps to.
+func (backend CIM) FieldMatch(match FieldMatch) (string, error) {
+	field, ok := backend.DataModel.Fields[match.Field]
+	if !ok {
+		return "", fmt.Errorf("field %s isn't part of the %s data model", match.Field, backend.DataModel.Name)
+	}
+	if match.Comparator == "" && match.Value == "null" {
+		return "", fmt.Errorf("null values are not supported by data models")
+	}
+	if match.Comparator == "re" {
+		return "", fmt.Errorf("regular expressions are not supported by data models")
+	}
+
+	if match.Comparator == "exists" {
+		if match.Value == "true" {
+			return fmt.Sprintf("%s.%s=*", backend.DataModel.Dataset, field), nil
+		}
+		return fmt.Sprintf("(NOT %s.%s=*)", backend.DataModel.Dataset, field), nil
+	}
+
+	// tstats matches networks natively
+	if match.Comparator == "cidr" {
+		prefix, err := netip.ParsePrefix(match.Value)
+		if err != nil {
+			return "", fmt.Errorf("invalid cidr %s: %w", match.Value, err)
+		}
+		return fmt.Sprintf("%s.%s=\"%s\"", backend.DataModel.Dataset, field, prefix), nil
+	}
+
+	match.Field = field
+	result, err := backend.SPL.FieldMatch(match)
+	if err != nil {
+		return "", err
+	}
+	return backend.DataModel.Dataset + "." + result, nil
+}
+
+// LookupMatch returns an error, the lookup tables hold the values of Sigma fields rather than the data model's fields.
+func (CIM) LookupMatch(lookup Lookup) (string, error) {
+	return "", fmt.Errorf("lookups are not supported by data models")
+}
+
+// Filter returns an error, the filters of SPL search the raw events rather than the data model.
+func (CIM) Filter() (Backend, error) {
+	return nil, fmt.Errorf("filters are not supported by data models")
+}
+
+// Aggregation returns an error, aggregations are rendered by the raw search.
+func (CIM) Aggregation(aggregation sigma.Comparison, timeframe time.Duration) (string, error) {
+	return "", fmt.Errorf("aggregations are not supported by data models")
+}
+
+// Query renders a tstats search over the data model, split by the data model's grouping fields.
+func (backend CIM) Query(query Query) (string, error) {
+	if len(query.Near) > 0 {
+		return "", fmt.Errorf("near is not supported by data models")
+	}
+
+	result := "| tstats summariesonly=true count from datamodel=" + backend.DataModel.Name
+	if query.Search != "" {
+		result += " where " + query.Search
+	}
+	if len(backend.DataModel.GroupedBy) > 0 {
+		fields := make([]string, len(backend.DataModel.GroupedBy))
+		for i, field := range backend.DataModel.GroupedBy {
+			fields[i] = backend.DataModel.Dataset + "." + field
+		}
+		result += " by " + strings.Join(fields, " ")
+	}
+	return result, nil
+}
@@ -0,0 +1,203 @@
+package backends
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mtnmunuklu/bridge/sigma"
+)
+
+// EQL renders Sigma rules as Elastic Event Query Language queries.
+// The event category is chosen from the logsource category, and near aggregations are rendered as sequences.
+type EQL struct {
+	SequenceBy []string // The fields that the events of a near sequence must share, e.g. host.id
+}
+
+// eqlCategories maps Sigma logsource categories to EQL event categories.
+var eqlCategories = map[string]string{
+	"process_creation":     "process",
+	"process_termination":  "process",
+	"process_access":       "process",
+	"create_remote_thread": "process",
+	"network_connection":   "network",
+	"firewall":             "network",
+	"dns_query":            "dns",
+	"dns":                  "dns",
+	"file_event":           "file",
+	"file_change":          "file",
+	"file_delete":          "file",
+	"file_rename":          "file",
+	"file_access":          "file",
+	"registry_event":       "registry",
+	"registry_add":         "registry",
+	"registry_set":         "registry",
+	"registry_delete":      "registry",
+	"image_load":           "library",
+	"driver_load":          "driver",
+	"authentication":       "authentication",
+}
+
+// And joins the expressions with the and operator.
+func (EQL) And(exprs []string) (string, error) {
+	return strings.Join(exprs, " and "), nil
+}
+
+// Or joins the expressions with the or operator.
+func (EQL) Or(exprs []string) (string, error) {
+	return strings.Join(exprs, " or "), nil
+}
+
+// Not negates the expression with the not operator.
+func (EQL) Not(expr string) (string, error) {
+	return "not " + expr, nil
+}
+
+// Group wraps the expression in parentheses.
+func (EQL) Group(expr string) string {
+	return "(" + expr + ")"
+}
+
+// Keyword returns an error, EQL can only match fields.
+func (EQL) Keyword(value string) (string, error) {
+	return "", fmt.Errorf("keyword searches are not supported by the eql backend")
+}
+
+// FieldMatch renders the comparison using the EQL operators.
+// Case-insensitive comparisons use the : operator, which also handles wildcards, and like for case sensitive wildcards.
+func (EQL) FieldMatch(match FieldMatch) (string, error) {
+	field := eqlField(match.Field)
+
+	switch match.Comparator {
+	case "", "contains", "startswith", "endswith":
+		if match.Comparator == "" && match.Value == "null" {
+			return field + " == null", nil
+		}
+
+		tokens := withComparator(parseValue(match.Value), match.Comparator)
+		literal, leading, trailing, ok := simpleValue(tokens)
+		pattern := eqlString(wildcardPattern(tokens, "*", "?", eqlEscapeWildcards))
+		switch {
+		case ok && !leading && !trailing && match.Comparator == "" && isNumber(literal):
+			return field + " == " + literal, nil
+		case !match.CaseSensitive:
+			return field + " : " + pattern, nil
+		case ok && !leading && !trailing:
+			return field + " == " + eqlString(literal), nil
+		default:
+			return field + " like " + pattern, nil
+		}
+
+	case "re":
+		// Sigma regular expressions are case-sensitive unless the i flag is set. The dot already matches newlines.
+		flags, pattern := regexFlags(match.Value)
+		if strings.Contains(flags, "m") {
+			return "", fmt.Errorf("the m flag of regular expressions is not supported by the eql backend")
+		}
+		if strings.Contains(flags, "i") {
+			return field + " regex~ " + eqlString(pattern), nil
+		}
+		return field + " regex " + eqlString(pattern), nil
+
+	case "exists":
+		if match.Value == "true" {
+			return field + " != null", nil
+		}
+		return "(" + field + " == null)", nil
+
+	case "cidr":
+		return "cidrMatch(" + field + ", " + eqlString(match.Value) + ")", nil
+
+	case "gt", "gte", "lt", "lte":
+		if !isNumber(match.Value) {
+			return "", fmt.Errorf("comparator %s expects a number, got %s", match.Comparator, match.Value)
+		}
+		return field + " " + comparisonOperators[match.Comparator] + " " + match.Value, nil
+
+	default:
+		return "", fmt.Errorf("comparator %s is not supported by the eql backend", match.Comparator)
+	}
+}
+
+// Aggregation returns an error, EQL has no aggregation functions.
+func (EQL) Aggregation(aggregation sigma.Comparison, timeframe time.Duration) (string, error) {
+	return "", fmt.Errorf("aggregations are not supported by the eql backend")
+}
+
+// Query renders the search as an event query of the logsource's category.
+// If the condition has a near aggregation, the search and the near searches are rendered as a sequence bounded by the timeframe,
+// joined by the SequenceBy fields. EQL sequences are ordered, so unlike near in Sigma, the events are expected in the order
+// they appear in the condition.
+func (backend EQL) Query(query Query) (string, error) {
+	category := eqlCategories[query.Logsource.Category]
+	if category == "" {
+		category = "any"
+	}
+
+	search := query.Search
+	if search == "" {
+		search = "true"
+	}
+	if len(query.Near) == 0 {
+		return category + " where " + search, nil
+	}
+
+	if query.Timeframe == 0 {
+		return "", fmt.Errorf("near requires a timeframe")
+	}
+	queries := []string{category + " where " + search}
+	for _, near := range query.Near {
+		queries = append(queries, category+" where "+near)
+	}
+	return eqlSequence(backend.SequenceBy, query.Timeframe, queries), nil
+}
+
+// Correlation renders temporal_ordered correlations as a sequence of the queries of the referenced rules, joined by the group-by fields
+// and bounded by the timespan. EQL sequences are ordered, so temporal correlations, whose events can occur in any order,
+// are not supported, and neither are the other correlations, as EQL can't count events.
+func (EQL) Correlation(correlation Correlation) (string, error) {
+	if correlation.Type != sigma.TemporalOrdered {
+		return "", fmt.Errorf("%s correlations are not supported by the eql backend", correlation.Type)
+	}
+	if correlation.Timespan == 0 {
+		return "", fmt.Errorf("%s correlations require a timespan", correlation.Type)
+	}
+	return eqlSequence(correlation.GroupBy, correlation.Timespan, correlation.Queries), nil
+}
+
+// eqlSequence renders a sequence of the queries, joined by the fields and bounded by the timeframe.
+func eqlSequence(by []string, timeframe time.Duration, queries []string) string {
+	result := "sequence"
+	if len(by) > 0 {
+		fields := make([]string, len(by))
+		for i, field := range by {
+			fields[i] = eqlField(field)
+		}
+		result += " by " + strings.Join(fields, ", ")
+	}
+	result += " with maxspan=" + formatTimeframe(timeframe)
+	for _, query := range queries {
+		result += "\n  [" + query + "]"
+	}
+	return result
+}
+
+// eqlField escapes a field name with backticks if it isn't a plain dotted identifier.
+func eqlField(field string) string {
+	for _, r := range field {
+		if !(r == '_' || r == '.' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return "`" + strings.ReplaceAll(field, "`", "``") + "`"
+		}
+	}
+	return field
+}
+
+// eqlEscapeWildcards escapes the literal backslashes, * and ? of a wildcard pattern.
+func eqlEscapeWildcards(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "*", "\\*", "?", "\\?").Replace(value)
+}
+
+// eqlString quotes a value as an EQL string literal.
+func eqlString(value string) string {
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(value) + "\""
+}
@@ -0,0 +1,33 @@
+package backends
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mtnmunuklu/bridge/sigma"
+)
+
+func TestEQLCorrelation(t *testing.T) {
+	correlation := Correlation{
+		Type:     sigma.TemporalOrdered,
+		Queries:  []string{"any where EventID == 4625", "any where EventID == 4624"},
+		GroupBy:  []string{"user"},
+		Timespan: time.Hour,
+	}
+	result, err := EQL{}.Correlation(correlation)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "sequence by user with maxspan=1h\n  [any where EventID == 4625]\n  [any where EventID == 4624]"
+	if result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+
+	// Sequences are ordered, so they can't match the events of temporal correlations in any order
+	for _, correlationType := range []sigma.CorrelationType{sigma.Temporal, sigma.EventCount, sigma.ValueCount} {
+		correlation.Type = correlationType
+		if _, err := (EQL{}).Correlation(correlation); err == nil {
+			t.Errorf("expected %s correlations to be unsupported", correlationType)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package backends
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mtnmunuklu/bridge/sigma"
+)
+
+// KQL renders Sigma rules as Kusto Query Language queries for Microsoft Sentinel.
+// The indexes of the config's logsource mappings are used as the table names.
+type KQL struct{}
+
+// And joins the expressions with the and operator.
+func (KQL) And(exprs []string) (string, error) {
+	return strings.Join(exprs, " and "), nil
+}
+
+// Or joins the expressions with the or operator.
+func (KQL) Or(exprs []string) (string, error) {
+	return strings.Join(exprs, " or "), nil
+}
+
+// Not negates the expression with the not() function.
+func (KQL) Not(expr string) (string, error) {
+	return "not(" + expr + ")", nil
+}
+
+// Group wraps the expression in parentheses.
+func (KQL) Group(expr string) string {
+	return "(" + expr + ")"
+}
+
+// Keyword searches for the value as a term in all columns.
+func (KQL) Keyword(value string) (string, error) {
+	return "* has " + kqlString(value), nil
+}
+
+// FieldMatch renders the comparison using the KQL string operators.
+func (KQL) FieldMatch(match FieldMatch) (string, error) {
+	field := kqlField(match.Field)
+
+	switch match.Comparator {
+	case "", "contains", "startswith", "endswith":
+		if match.Comparator == "" && match.Value == "null" {
+			return "isempty(" + field + ")", nil
+		}
+
+		tokens := withComparator(parseValue(match.Value), match.Comparator)
+		literal, leading, trailing, ok := simpleValue(tokens)
+		if !ok {
+			// Wildcards in the middle of the value can only be expressed with a regular expression
+			return field + " matches regex " + kqlString(kqlRegex(regexPattern(tokens), match.CaseSensitive)), nil
+		}
+
+		var operator string
+		switch {
+		case leading && trailing && kqlTerm(literal):
+			// Whole terms are looked up in the term index, which is faster than scanning for a substring
+			operator = "has"
+		case leading && trailing:
+			operator = "contains"
+		case trailing:
+			operator = "startswith"
+		case leading:
+			operator = "endswith"
+		case match.CaseSensitive:
+			return field + " == " + kqlString(literal), nil
+		case match.Comparator == "" && isNumber(literal):
+			// Numeric columns can't be compared with strings
+			return field + " == " + literal, nil
+		default:
+			return field + " =~ " + kqlString(literal), nil
+		}
+		if match.CaseSensitive {
+			operator += "_cs"
+		}
+		return field + " " + operator + " " + kqlString(literal), nil
+
+	case "re":
+		return field + " matches regex " + kqlString(match.Value), nil
+
+	case "exists":
+		if match.Value == "true" {
+			return "isnotempty(" + field + ")", nil
+		}
+		return "isempty(" + field + ")", nil
+
+	case "cidr":
+		if strings.Contains(match.Value, ":") {
+			return "ipv6_is_in_range(" + field + ", " + kqlString(match.Value) + ")", nil
+		}
+		return "ipv4_is_in_range(" + field + ", " + kqlString(match.Value) + ")", nil
+
+	case "gt", "gte", "lt", "lte":
+		return field + " " + comparisonOperators[match.Comparator] + " " + kqlNumber(match.Value), nil
+
+	default:
+		return "", fmt.Errorf("comparator %s is not supported by the kql backend", match.Comparator)
+	}
+}
+
+// Aggregation renders the aggregation as a summarize operator followed by a where clause on the aggregated value.
+// If the rule has a timeframe, the events are binned by their TimeGenerated column.
+func (KQL) Aggregation(aggregation sigma.Comparison, timeframe time.Duration) (string, error) {
+	var function, field, groupedBy string
+	switch agg := aggregation.Func.(type) {
+	case sigma.Count:
+		function, field, groupedBy = "count", agg.Field, agg.GroupedBy
+		if field != "" {
+			// Counting a field counts its distinct values
+			function = "dcount"
+		}
+	case sigma.Average:
+		function, field, groupedBy = "avg", agg.Field, agg.GroupedBy
+	case sigma.Sum:
+		function, field, groupedBy = "sum", agg.Field, agg.GroupedBy
+	case sigma.Min:
+		function, field, groupedBy = "min", agg.Field, agg.GroupedBy
+	case sigma.Max:
+		function, field, groupedBy = "max", agg.Field, agg.GroupedBy
+	default:
+		return "", fmt.Errorf("unsupported aggregation function")
+	}
+
+	if field != "" {
+		field = kqlField(field)
+	}
+	result := "| summarize value = " + function + "(" + field + ")"
+
+	var by []string
+	if groupedBy != "" {
+		by = append(by, kqlField(groupedBy))
+	}
+	if timeframe != 0 {
+		by = append(by, "bin(TimeGenerated, "+formatTimeframe(timeframe)+")")
+	}
+	if len(by) > 0 {
+		result += " by " + strings.Join(by, ", ")
+	}
+
+	operator := string(aggregation.Op)
+	if aggregation.Op == sigma.Equal {
+		operator = "=="
+	}
+	return result + " | where value " + operator + " " + strconv.FormatFloat(aggregation.Threshold, 'f', -1, 64), nil
+}
+
+// Query filters the tables of the logsource with the search and appends the aggregation.
+func (KQL) Query(query Query) (string, error) {
+	if len(query.Near) > 0 {
+		return "", fmt.Errorf("near is not supported by the kql backend")
+	}
+
+	var result string
+	switch len(query.Indexes) {
+	case 0:
+		return "", fmt.Errorf("no table found for logsource %s/%s/%s, set an index in the config", query.Logsource.Category, query.Logsource.Product, query.Logsource.Service)
+	case 1:
+		result = query.Indexes[0]
+	default:
+		result = "union " + strings.Join(query.Indexes, ", ")
+	}
+
+	if query.Search != "" {
+		result += " | where " + query.Search
+	}
+	if query.Aggregation != "" {
+		result += " " + query.Aggregation
+	}
+	return result, nil
+}
+
+// comparisonOperators maps the numeric comparator modifiers to their operators.
+var comparisonOperators = map[string]string{
+	"gt":  ">",
+	"gte": ">=",
+	"lt":  "<",
+	"lte": "<=",
+}
+
+// kqlField quotes a column name if it isn't a plain identifier.
+func kqlField(field string) string {
+	for _, r := range field {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return "['" + strings.ReplaceAll(field, "'", "\\'") + "']"
+		}
+	}
+	return field
+}
+
+// kqlTerm reports whether the value is a single term of the KQL term index, made up of alphanumeric characters only.
+func kqlTerm(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// kqlString quotes a value as a KQL string literal.
+func kqlString(value string) string {
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(value) + "\""
+}
+
+// kqlNumber returns the value unquoted if it is a number, otherwise it is quoted as a string literal.
+func kqlNumber(value string) string {
+	if isNumber(value) {
+		return value
+	}
+	return kqlString(value)
+}
+
+// kqlRegex makes the regular expression case-insensitive unless the comparison is case sensitive.
+func kqlRegex(pattern string, caseSensitive bool) string {
+	if caseSensitive {
+		return pattern
+	}
+	return "(?i)" + pattern
+}
@@ -0,0 +1,31 @@
+package backends
+
+import "testing"
+
+func TestKQLFieldMatchContains(t *testing.T) {
+	tests := []struct {
+		name          string
+		value         string
+		caseSensitive bool
+		expected      string
+	}{
+		{"whole term", "mimikatz", false, `CommandLine has "mimikatz"`},
+		{"case sensitive term", "mimikatz", true, `CommandLine has_cs "mimikatz"`},
+		// Values with separators span several terms, which has can't match as a substring
+		{"separator", "mimikatz.exe", false, `CommandLine contains "mimikatz.exe"`},
+		{"space", "sekurlsa logonpasswords", false, `CommandLine contains "sekurlsa logonpasswords"`},
+		{"wildcard", "mimi*katz", false, `CommandLine matches regex "(?i)^.*mimi.*katz.*$"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := KQL{}.FieldMatch(FieldMatch{Field: "CommandLine", Comparator: "contains", Value: tt.value, CaseSensitive: tt.caseSensitive})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package backends
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mtnmunuklu/bridge/sigma"
+)
+
+// LogQL renders Sigma rules as Grafana Loki LogQL queries.
+// The indexes of the config's logsource mappings form the stream selector, keyword searches become line filters
+// and field matches become label filters after a json parser stage.
+//
+// Line filters can only be chained, so keyword searches can't be ORed with field matches.
+// An expression rendered by this backend is therefore made up of lines: one line per line filter,
+// followed by at most one line holding the label filter expression.
+// LogQL has no negation operator either, so the evaluator pushes negations down to the line and label filters.
+type LogQL struct{}
+
+// logqlQueryPlaceholder marks the position of the log query in a rendered aggregation.
+const logqlQueryPlaceholder = "\x00"
+
+// And chains the line filters of the expressions and joins their label filters with the and operator.
+func (LogQL) And(exprs []string) (string, error) {
+	var lineFilters, labelFilters []string
+	for _, expr := range exprs {
+		lines, labels := logqlSplit(expr)
+		lineFilters = append(lineFilters, lines...)
+		if labels != "" {
+			labelFilters = append(labelFilters, labels)
+		}
+	}
+	return logqlJoin(lineFilters, strings.Join(labelFilters, " and ")), nil
+}
+
+// Or joins label filters with the or operator. Positive line filters are merged into a single regular expression.
+func (LogQL) Or(exprs []string) (string, error) {
+	var labelFilters, patterns []string
+	for _, expr := range exprs {
+		lines, labels := logqlSplit(expr)
+		switch {
+		case len(lines) == 0:
+			labelFilters = append(labelFilters, labels)
+		case len(lines) == 1 && labels == "" && (strings.HasPrefix(lines[0], "|=") || strings.HasPrefix(lines[0], "|~")):
+			pattern, err := strconv.Unquote(strings.TrimSpace(lines[0][2:]))
+			if err != nil {
+				return "", err
+			}
+			if strings.HasPrefix(lines[0], "|=") {
+				pattern = regexp.QuoteMeta(pattern)
+			}
+			patterns = append(patterns, "(?:"+pattern+")")
+		default:
+			return "", fmt.Errorf("keyword searches can only be combined with and in the logql backend")
+		}
+	}
+
+	switch {
+	case len(patterns) > 0 && len(labelFilters) > 0:
+		return "", fmt.Errorf("keyword searches can only be combined with and in the logql backend")
+	case len(patterns) > 0:
+		return "|~ " + strconv.Quote(strings.Join(patterns, "|")), nil
+	default:
+		return strings.Join(labelFilters, " or "), nil
+	}
+}
+
+// Not returns an error, the evaluator pushes negations down to the line and label filters instead.
+func (LogQL) Not(expr string) (string, error) {
+	return "", fmt.Errorf("negations are pushed down by the logql backend")
+}
+
+// Group wraps the label filter expression in parentheses. Line filters are left as they are.
+func (LogQL) Group(expr string) string {
+	lines, labels := logqlSplit(expr)
+	if labels != "" {
+		labels = "(" + labels + ")"
+	}
+	return logqlJoin(lines, labels)
+}
+
+// Keyword renders a line filter for the value.
+func (LogQL) Keyword(value string) (string, error) {
+	return logqlKeyword(value, "|=", "|~"), nil
+}
+
+// NotKeyword renders a line filter for lines that don't contain the value.
+func (LogQL) NotKeyword(value string) (string, error) {
+	return logqlKeyword(value, "!=", "!~"), nil
+}
+
+// FieldMatch renders the comparison as a label filter.
+func (LogQL) FieldMatch(match FieldMatch) (string, error) {
+	return logqlFieldMatch(match, false)
+}
+
+// NotFieldMatch renders the negated comparison as a label filter.
+func (LogQL) NotFieldMatch(match FieldMatch) (string, error) {
+	return logqlFieldMatch(match, true)
+}
+
+// Aggregation renders the aggregation as a metric query over the rule's timeframe.
+// The log query is inserted by Query.
+func (LogQL) Aggregation(aggregation sigma.Comparison, timeframe time.Duration) (string, error) {
+	if timeframe == 0 {
+		return "", fmt.Errorf("aggregations require a timeframe in the logql backend")
+	}
+	rangeSelector := " [" + formatTimeframe(timeframe) + "]"
+
+	var result string
+	switch agg := aggregation.Func.(type) {
+	case sigma.Count:
+		result = "count_over_time(" + logqlQueryPlaceholder + rangeSelector + ")"
+		switch {
+		case agg.Field != "" && agg.GroupedBy != "":
+			// Counting a field counts its distinct values
+			result = "count by (" + logqlLabel(agg.GroupedBy) + ") (sum by (" + logqlLabel(agg.GroupedBy) + ", " + logqlLabel(agg.Field) + ") (" + result + "))"
+		case agg.Field != "":
+			result = "count(sum by (" + logqlLabel(agg.Field) + ") (" + result + "))"
+		case agg.GroupedBy != "":
+			result = "sum by (" + logqlLabel(agg.GroupedBy) + ") (" + result + ")"
+		default:
+			result = "sum(" + result + ")"
+		}
+	case sigma.Average:
+		result = logqlUnwrap("avg_over_time", agg.Field, agg.GroupedBy, rangeSelector)
+	case sigma.Sum:
+		result = logqlUnwrap("sum_over_time", agg.Field, agg.GroupedBy, rangeSelector)
+	case sigma.Min:
+		result = logqlUnwrap("min_over_time", agg.Field, agg.GroupedBy, rangeSelector)
+	case sigma.Max:
+		result = logqlUnwrap("max_over_time", agg.Field, agg.GroupedBy, rangeSelector)
+	default:
+		return "", fmt.Errorf("unsupported aggregation function")
+	}
+
+	operator := string(aggregation.Op)
+	if aggregation.Op == sigma.Equal {
+		operator = "=="
+	}
+	return result + " " + operator + " " + strconv.FormatFloat(aggregation.Threshold, 'f', -1, 64), nil
+}
+
+// Query renders the stream selector followed by the line filters, the json parser and the label filters.
+// If the condition has an aggregation, the log query is wrapped in it.
+func (LogQL) Query(query Query) (string, error) {
+	if len(query.Near) > 0 {
+		return "", fmt.Errorf("near is not supported by the logql backend")
+	}
+
+	result, err := logqlSelector(query.Indexes)
+	if err != nil {
+		return "", err
+	}
+
+	lines, labels := logqlSplit(query.Search)
+	for _, line := range lines {
+		result += " " + line
+	}
+	if labels != "" || query.Aggregation != "" {
+		result += " | json"
+	}
+	if labels != "" {
+		result += " | " + labels
+	}
+
+	if query.Aggregation != "" {
+		return strings.Replace(query.Aggregation, logqlQueryPlaceholder, result, 1), nil
+	}
+	return result, nil
+}
+
+// logqlSelector renders the stream selector for the indexes.
+// Indexes that are label matchers (e.g. namespace="prod") are used as they are, all others are matched against the job label.
+func logqlSelector(indexes []string) (string, error) {
+	var matchers, jobs []string
+	for _, index := range indexes {
+		if strings.ContainsAny(index, "=~") {
+			matchers = append(matchers, index)
+		} else {
+			jobs = append(jobs, index)
+		}
+	}
+
+	switch {
+	case len(jobs) == 1:
+		matchers = append(matchers, "job="+strconv.Quote(jobs[0]))
+	case len(jobs) > 1:
+		for i, job := range jobs {
+			jobs[i] = regexp.QuoteMeta(job)
+		}
+		matchers = append(matchers, "job=~"+strconv.Quote(strings.Join(jobs, "|")))
+	}
+
+	if len(matchers) == 0 {
+		return "", fmt.Errorf("no stream selector found for logsource, set an index in the config")
+	}
+	return "{" + strings.Join(matchers, ", ") + "}", nil
+}
+
+// logqlFieldMatch renders the (negated) comparison as a label filter.
+func logqlFieldMatch(match FieldMatch, negated bool) (string, error) {
+	label := logqlLabel(match.Field)
+	equal, regex := "=", "=~"
+	if negated {
+		equal, regex = "!=", "!~"
+	}
+
+	switch match.Comparator {
+	case "", "contains", "startswith", "endswith":
+		if match.Comparator == "" && match.Value == "null" {
+			return label + equal + "\"\"", nil
+		}
+
+		tokens := withComparator(parseValue(match.Value), match.Comparator)
+		literal, leading, trailing, ok := simpleValue(tokens)
+		if ok && !leading && !trailing && (match.CaseSensitive || strings.ToLower(literal) == strings.ToUpper(literal)) {
+			return label + equal + strconv.Quote(literal), nil
+		}
+		// Label filter regular expressions are anchored, so the wildcards are enough
+		pattern := wildcardPattern(tokens, ".*", ".", regexp.QuoteMeta)
+		if !match.CaseSensitive {
+			pattern = "(?i)" + pattern
+		}
+		return label + regex + strconv.Quote(pattern), nil
+
+	case "re":
+		return label + regex + strconv.Quote(".*(?:"+match.Value+").*"), nil
+
+	case "exists":
+		// A label that isn't set is matched as an empty label
+		if (match.Value == "true") != negated {
+			return label + "!=\"\"", nil
+		}
+		return label + "=\"\"", nil
+
+	case "cidr":
+		return label + " " + equal + " ip(" + strconv.Quote(match.Value) + ")", nil
+
+	case "gt", "gte", "lt", "lte":
+		if !isNumber(match.Value) {
+			return "", fmt.Errorf("comparator %s expects a number, got %s", match.Comparator, match.Value)
+		}
+		comparator := match.Comparator
+		if negated {
+			comparator = map[string]string{"gt": "lte", "gte": "lt", "lt": "gte", "lte": "gt"}[comparator]
+		}
+		return label + " " + comparisonOperators[comparator] + " " + match.Value, nil
+
+	default:
+		return "", fmt.Errorf("comparator %s is not supported by the logql backend", match.Comparator)
+	}
+}
+
+// logqlKeyword renders a line filter for the value, using the regular expression operator if the value has wildcards or letters.
+func logqlKeyword(value, contains, matches string) string {
+	tokens := parseValue(value)
+	if literal, leading, trailing, ok := simpleValue(tokens); ok && !leading && !trailing && strings.ToLower(literal) == strings.ToUpper(literal) {
+		return contains + " " + strconv.Quote(literal)
+	}
+	// Keywords are case-insensitive and line filter regular expressions aren't anchored
+	return matches + " " + strconv.Quote("(?i)"+wildcardPattern(tokens, ".*", ".", regexp.QuoteMeta))
+}
+
+// logqlUnwrap renders a range aggregation over the values of a field.
+func logqlUnwrap(function, field, groupedBy, rangeSelector string) string {
+	result := function + "(" + logqlQueryPlaceholder + " | unwrap " + logqlLabel(field) + rangeSelector + ")"
+	if groupedBy != "" {
+		result += " by (" + logqlLabel(groupedBy) + ")"
+	}
+	return result
+}
+
+// logqlLabel converts a field name to the label name extracted by the json parser, which replaces invalid characters with underscores.
+func logqlLabel(field string) string {
+	label := []rune(field)
+	for i, r := range label {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' && i > 0) {
+			label[i] = '_'
+		}
+	}
+	return string(label)
+}
+
+// logqlSplit splits an expression rendered by this backend into its line filters and its label filter expression.
+func logqlSplit(expr string) ([]string, string) {
+	var lines []string
+	var labels string
+	for _, line := range strings.Split(expr, "\n") {
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "|=") || strings.HasPrefix(line, "|~") || strings.HasPrefix(line, "!=") || strings.HasPrefix(line, "!~"):
+			lines = append(lines, line)
+		default:
+			labels = line
+		}
+	}
+	return lines, labels
+}
+
+// logqlJoin joins line filters and a label filter expression into a single expression of this backend.
+func logqlJoin(lines []string, labels string) string {
+	if labels != "" {
+		lines = append(lines, labels)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,135 @@
+package backends
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mtnmunuklu/bridge/sigma"
+)
+
+// Lucene renders Sigma rules as Lucene query strings for Elasticsearch and Kibana.
+// The indexes of the config's logsource mappings are used as index patterns.
+type Lucene struct {
+	DefaultField string // The field that keyword searches are run against, empty for the default field of the index
+}
+
+// And joins the expressions with the AND operator.
+func (Lucene) And(exprs []string) (string, error) {
+	return strings.Join(exprs, " AND "), nil
+}
+
+// Or joins the expressions with the OR operator.
+func (Lucene) Or(exprs []string) (string, error) {
+	return strings.Join(exprs, " OR "), nil
+}
+
+// Not negates the expression with the NOT operator.
+func (Lucene) Not(expr string) (string, error) {
+	return "NOT " + expr, nil
+}
+
+// Group wraps the expression in parentheses.
+func (Lucene) Group(expr string) string {
+	return "(" + expr + ")"
+}
+
+// Keyword searches for the value in the default field.
+func (backend Lucene) Keyword(value string) (string, error) {
+	query := luceneValue(parseValue(value))
+	if backend.DefaultField != "" {
+		query = luceneEscape(backend.DefaultField) + ":" + query
+	}
+	return query, nil
+}
+
+// FieldMatch renders the comparison as a field query, using wildcards for the contains, startswith and endswith comparators.
+func (Lucene) FieldMatch(match FieldMatch) (string, error) {
+	field := luceneEscape(match.Field)
+
+	switch match.Comparator {
+	case "", "contains", "startswith", "endswith":
+		if match.Comparator == "" && match.Value == "null" {
+			return "NOT _exists_:" + field, nil
+		}
+		return field + ":" + luceneValue(withComparator(parseValue(match.Value), match.Comparator)), nil
+
+	case "re":
+		// Lucene regular expressions can't be made case-insensitive, and the dot already matches newlines
+		flags, pattern := regexFlags(match.Value)
+		if strings.ContainsAny(flags, "im") {
+			return "", fmt.Errorf("the %s flags of regular expressions are not supported by the lucene backend", flags)
+		}
+		return field + ":/" + strings.ReplaceAll(pattern, "/", "\\/") + "/", nil
+
+	case "exists":
+		if match.Value == "true" {
+			return "_exists_:" + field, nil
+		}
+		return "(NOT _exists_:" + field + ")", nil
+
+	case "cidr":
+		return field + ":" + luceneString(match.Value), nil
+
+	case "gt", "gte", "lt", "lte":
+		return field + ":" + comparisonOperators[match.Comparator] + luceneEscape(match.Value), nil
+
+	default:
+		return "", fmt.Errorf("comparator %s is not supported by the lucene backend", match.Comparator)
+	}
+}
+
+// Aggregation returns an error, query strings can't express aggregations.
+func (Lucene) Aggregation(aggregation sigma.Comparison, timeframe time.Duration) (string, error) {
+	return "", fmt.Errorf("aggregations are not supported by the lucene backend")
+}
+
+// Query restricts the search to the index patterns of the logsource.
+func (Lucene) Query(query Query) (string, error) {
+	if len(query.Near) > 0 {
+		return "", fmt.Errorf("near is not supported by the lucene backend")
+	}
+
+	if len(query.Indexes) == 0 {
+		return query.Search, nil
+	}
+
+	patterns := make([]string, len(query.Indexes))
+	for i, index := range query.Indexes {
+		patterns[i] = wildcardPattern(parseValue(index), "*", "?", luceneEscape)
+	}
+	result := "_index:" + patterns[0]
+	if len(patterns) > 1 {
+		result = "_index:(" + strings.Join(patterns, " OR ") + ")"
+	}
+
+	if query.Search != "" {
+		result += " AND (" + query.Search + ")"
+	}
+	return result, nil
+}
+
+// luceneValue renders a Sigma value as a quoted phrase, or as an escaped term if it contains wildcards.
+func luceneValue(tokens []valueToken) string {
+	if literal, leading, trailing, ok := simpleValue(tokens); ok && !leading && !trailing {
+		return luceneString(literal)
+	}
+	return wildcardPattern(tokens, "*", "?", luceneEscape)
+}
+
+// luceneString quotes a value as a Lucene phrase.
+func luceneString(value string) string {
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(value) + "\""
+}
+
+// luceneEscape escapes the reserved characters and whitespace of the Lucene query string syntax with backslashes.
+func luceneEscape(value string) string {
+	var builder strings.Builder
+	for _, r := range value {
+		if strings.ContainsRune(`+-=&|><!(){}[]^"~*?:\/ `, r) {
+			builder.WriteRune('\\')
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
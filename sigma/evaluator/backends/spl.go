@@ -0,0 +1,443 @@
+package backends
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mtnmunuklu/bridge/sigma"
+	"github.com/mtnmunuklu/bridge/sigma/evaluator/modifiers"
+)
+
+// SPL renders Sigma rules as Splunk Processing Language searches.
+type SPL struct{}
+
+// And joins the expressions with spaces, which Splunk treats as an implicit AND.
+func (SPL) And(exprs []string) (string, error) {
+	return strings.Join(exprs, " "), nil
+}
+
+// Or joins the expressions with the OR operator.
+func (SPL) Or(exprs []string) (string, error) {
+	return strings.Join(exprs, " OR "), nil
+}
+
+// Not negates the expression with the NOT operator.
+func (SPL) Not(expr string) (string, error) {
+	return "NOT " + expr, nil
+}
+
+// Group wraps the expression in parentheses.
+func (SPL) Group(expr string) string {
+	return "(" + expr + ")"
+}
+
+// Keyword renders the value as a quoted search term.
+func (SPL) Keyword(value string) (string, error) {
+	return fmt.Sprintf("\"%s\"", value), nil
+}
+
+// FieldMatch renders the comparison using the SPL comparators of the modifiers package.
+// Regular expressions can't be part of a search, so rules that have them are rendered with the filter backend.
+// IPv4 networks are searched with the wildcard terms of the octet-aligned networks they are made up of,
+// rules with any other network are rendered with the filter backend as well.
+func (SPL) FieldMatch(match FieldMatch) (string, error) {
+	switch match.Comparator {
+	case "re":
+		return "", ErrFilterRequired
+
+	case "cidr":
+		terms, ok, err := splCIDRTerms(match.Value)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", ErrFilterRequired
+		}
+
+		results := make([]string, len(terms))
+		for i, term := range terms {
+			results[i], err = splFieldMatch(FieldMatch{Field: match.Field, Value: term, CaseSensitive: match.CaseSensitive})
+			if err != nil {
+				return "", err
+			}
+		}
+		if len(results) == 1 {
+			return results[0], nil
+		}
+		return "(" + strings.Join(results, " OR ") + ")", nil
+	}
+	return splFieldMatch(match)
+}
+
+// splCIDRExpansionLimit is the largest number of wildcard terms that an IPv4 network is expanded into.
+const splCIDRExpansionLimit = 16
+
+// splCIDRTerms expands an IPv4 network into the wildcard terms of the octet-aligned networks it is made up of,
+// e.g. 10.0.0.0/23 into 10.0.0.* and 10.0.1.*. It returns false for IPv6 networks,
+// and for networks that would need more than splCIDRExpansionLimit terms.
+func splCIDRTerms(value string) ([]string, bool, error) {
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid cidr %s: %w", value, err)
+	}
+	if !prefix.Addr().Is4() {
+		return nil, false, nil
+	}
+
+	// Round the prefix length up to whole octets
+	prefix = prefix.Masked()
+	bits := (prefix.Bits() + 7) / 8 * 8
+	count := 1 << (bits - prefix.Bits())
+	if count > splCIDRExpansionLimit {
+		return nil, false, nil
+	}
+
+	address := prefix.Addr().As4()
+	start := binary.BigEndian.Uint32(address[:])
+	terms := make([]string, count)
+	for i := range terms {
+		binary.BigEndian.PutUint32(address[:], start+uint32(i)<<(32-bits))
+		octets := make([]string, 0, 4)
+		for _, octet := range address[:bits/8] {
+			octets = append(octets, strconv.Itoa(int(octet)))
+		}
+		if bits < 32 {
+			octets = append(octets, "*")
+		}
+		terms[i] = strings.Join(octets, ".")
+	}
+	return terms, true, nil
+}
+
+// splFieldMatch renders the comparison using the SPL comparators of the modifiers package.
+func splFieldMatch(match FieldMatch) (string, error) {
+	var names []string
+	if match.Comparator != "" {
+		names = append(names, match.Comparator)
+	}
+
+	comparator, err := modifiers.GetComparator(names...)
+	if match.CaseSensitive {
+		comparator, err = modifiers.GetComparatorCaseSensitive(names...)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return comparator(match.Field, match.Value)
+}
+
+// LookupMatch renders a subsearch that returns the values of the lookup table as searches of the field.
+// Lookup tables that are joined with the events with the lookup command are rendered with the filter backend.
+func (SPL) LookupMatch(lookup Lookup) (string, error) {
+	switch lookup.Strategy {
+	case "", sigma.LookupSubsearch:
+		field, column := splLookupFields(lookup)
+		result := "[| inputlookup " + lookup.Lookup
+		if column != field {
+			result += " | rename " + column + " AS " + field
+		}
+		return result + " | fields " + field + "]", nil
+	case sigma.LookupCommand:
+		return "", ErrFilterRequired
+	}
+	return "", fmt.Errorf("unknown lookup strategy %s for lookup %s", lookup.Strategy, lookup.Lookup)
+}
+
+// splLookupFields returns the event field and the column of the lookup table that holds its values.
+func splLookupFields(lookup Lookup) (string, string) {
+	field := strings.ToLower(lookup.Field)
+	if lookup.PlaceholderLookup.Field != "" {
+		return field, lookup.PlaceholderLookup.Field
+	}
+	return field, field
+}
+
+// splLookupName matches the characters that can't be part of the name of the output field of a lookup command.
+var splLookupName = regexp.MustCompile(`\W`)
+
+// splLookupOutput returns the name of the field that the lookup command sets on the events that are found in the lookup table.
+func splLookupOutput(lookup Lookup) string {
+	field, _ := splLookupFields(lookup)
+	name := strings.TrimSuffix(lookup.Lookup, ".csv") + "_" + field
+	return "lookup_" + splLookupName.ReplaceAllString(name, "_")
+}
+
+// Aggregation renders the aggregation as a stats command over windows of the timeframe, followed by a where command
+// comparing the aggregated value to the threshold.
+func (backend SPL) Aggregation(aggregation sigma.Comparison, timeframe time.Duration) (string, error) {
+	// Evaluate the aggregation function
+	function, groupedBy, err := backend.aggregationFunc(aggregation.Func)
+	if err != nil {
+		return "", err
+	}
+
+	// Split the events into windows of the timeframe, if there is one
+	var result string
+	var by []string
+	if timeframe != 0 {
+		result = "| bin _time span=" + formatTimeframe(timeframe) + " "
+		by = append(by, "_time")
+	}
+	if groupedBy != "" {
+		by = append(by, groupedBy)
+	}
+
+	result += "| stats " + function + " as value"
+	if len(by) > 0 {
+		result += " by " + strings.Join(by, " ")
+	}
+
+	// Compare the aggregated value to the threshold
+	return result + " | where value " + string(aggregation.Op) + " " + strconv.FormatFloat(aggregation.Threshold, 'f', -1, 64), nil
+}
+
+// aggregationFunc renders the given aggregation function as a stats function and returns the field the results are grouped by.
+func (SPL) aggregationFunc(aggregation sigma.AggregationFunc) (string, string, error) {
+	switch agg := aggregation.(type) {
+	case sigma.Count:
+		// If the field is not specified, count all events, otherwise count the distinct values of the field
+		if agg.Field == "" {
+			return "count", agg.GroupedBy, nil
+		}
+		return "dc(" + agg.Field + ")", agg.GroupedBy, nil
+
+	case sigma.Average:
+		return "avg(" + agg.Field + ")", agg.GroupedBy, nil
+
+	case sigma.Sum:
+		return "sum(" + agg.Field + ")", agg.GroupedBy, nil
+
+	case sigma.Min:
+		return "min(" + agg.Field + ")", agg.GroupedBy, nil
+
+	case sigma.Max:
+		return "max(" + agg.Field + ")", agg.GroupedBy, nil
+
+	// If the aggregation function type is not supported, return an error.
+	default:
+		return "", "", fmt.Errorf("unsupported aggregation function")
+	}
+}
+
+// Query prefixes the search with the sourcetype derived from the logsource product and service.
+func (backend SPL) Query(query Query) (string, error) {
+	result := query.Search
+
+	// If the condition has a near aggregation, search for the events of all searches and keep those that occur within the timeframe
+	if len(query.Near) > 0 {
+		var err error
+		result, err = backend.near(query.Search, query.Near, query.Timeframe)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// If the condition has an aggregation, add the aggregation to the final query string
+	if query.Aggregation != "" {
+		result += " " + query.Aggregation
+	}
+
+	// Add the sourcetype condition to the final query string, if applicable
+	if sourcetype := splSourcetype(query.Logsource); sourcetype != "" {
+		result = sourcetype + " " + result
+	}
+
+	return result, nil
+}
+
+// splSourcetype returns the sourcetype condition derived from the logsource product and service, empty if there is no product.
+func splSourcetype(logsource sigma.Logsource) string {
+	switch {
+	case logsource.Product != "" && logsource.Service != "":
+		return fmt.Sprintf("sourcetype=\"%v\"", logsource.Product+"-"+logsource.Service)
+	case logsource.Product != "":
+		return fmt.Sprintf("sourcetype=\"%v\"", logsource.Product+"-*")
+	}
+	return ""
+}
+
+// Filter returns the backend that renders the conditions as where commands, for rules with regular expressions.
+func (backend SPL) Filter() (Backend, error) {
+	return SPLFilter{SPL: backend}, nil
+}
+
+// SPLFilter renders the conditions of Sigma rules as eval expressions of a where command, which unlike searches can match regular expressions
+// and networks. These are rendered with the match and cidrmatch functions, and any other keyword or field match with the searchmatch function,
+// so that the AND/OR/NOT structure of the condition is kept.
+type SPLFilter struct {
+	SPL
+}
+
+// And joins the expressions with the AND operator.
+func (SPLFilter) And(exprs []string) (string, error) {
+	return strings.Join(exprs, " AND "), nil
+}
+
+// Keyword renders a searchmatch of the quoted search term.
+func (backend SPLFilter) Keyword(value string) (string, error) {
+	keyword, err := backend.SPL.Keyword(value)
+	if err != nil {
+		return "", err
+	}
+	return "searchmatch(" + splString(keyword) + ")", nil
+}
+
+// FieldMatch renders regular expressions with the match function, networks with the cidrmatch function,
+// and any other comparison as a searchmatch of the search term.
+func (SPLFilter) FieldMatch(match FieldMatch) (string, error) {
+	result, err := splFieldMatch(match)
+	if err != nil || match.Comparator == "re" || match.Comparator == "cidr" {
+		return result, err
+	}
+	return "searchmatch(" + splString(result) + ")", nil
+}
+
+// LookupMatch checks that the field was found in the lookup table, which the events are joined with by the query.
+func (SPLFilter) LookupMatch(lookup Lookup) (string, error) {
+	switch lookup.Strategy {
+	case "", sigma.LookupSubsearch, sigma.LookupCommand:
+		return "isnotnull(" + splLookupOutput(lookup) + ")", nil
+	}
+	return "", fmt.Errorf("unknown lookup strategy %s for lookup %s", lookup.Strategy, lookup.Lookup)
+}
+
+// Query renders a where command on the events of the sourcetype, followed by the aggregation (if any).
+// The events are joined with the lookup tables that the search refers to before the where command.
+func (SPLFilter) Query(query Query) (string, error) {
+	if len(query.Near) > 0 {
+		return "", fmt.Errorf("near is not supported with regular expressions")
+	}
+
+	result := splSourcetype(query.Logsource)
+	if result == "" {
+		result = "*"
+	}
+	joined := make(map[string]bool)
+	for _, lookup := range query.Lookups {
+		output := splLookupOutput(lookup)
+		if joined[output] {
+			continue
+		}
+		joined[output] = true
+		field, column := splLookupFields(lookup)
+		result += fmt.Sprintf(" | lookup %s %s AS %s OUTPUT %s AS %s", lookup.Lookup, column, field, column, output)
+	}
+	result += " | where " + query.Search
+
+	// If the condition has an aggregation, add the aggregation to the final query string
+	if query.Aggregation != "" {
+		result += " " + query.Aggregation
+	}
+	return result, nil
+}
+
+// near renders a search for the events matching the search or any of the near searches.
+// Each event is flagged with the searches it matches, and streamstats carries the flags over a sliding window of the timeframe,
+// so that only events that have been preceded by events matching all of the searches within the timeframe are kept.
+func (SPL) near(search string, near []string, timeframe time.Duration) (string, error) {
+	if timeframe == 0 {
+		return "", fmt.Errorf("near requires a timeframe")
+	}
+
+	searches := append([]string{search}, near...)
+	terms := make([]string, len(searches))
+	flags := make([]string, len(searches))
+	windows := make([]string, len(searches))
+	conditions := make([]string, len(searches))
+	for i, search := range searches {
+		flag := fmt.Sprintf("near_%d", i)
+		terms[i] = "(" + search + ")"
+		flags[i] = fmt.Sprintf("%s=if(searchmatch(%s), 1, 0)", flag, splString(search))
+		windows[i] = fmt.Sprintf("max(%s) as %s", flag, flag)
+		conditions[i] = flag + "=1"
+	}
+
+	return "(" + strings.Join(terms, " OR ") + ")" +
+		" | eval " + strings.Join(flags, ", ") +
+		" | streamstats time_window=" + formatTimeframe(timeframe) + " " + strings.Join(windows, " ") +
+		" | where " + strings.Join(conditions, " AND "), nil
+}
+
+// splString quotes a value as an SPL string literal for eval expressions.
+func splString(value string) string {
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(value) + "\""
+}
+
+// Correlation searches for the events of all referenced rules and aggregates them over windows of the timespan.
+// Temporal correlations tag each event with the rule it matches, and count the distinct rules or check their order per window.
+func (backend SPL) Correlation(correlation Correlation) (string, error) {
+	terms := make([]string, len(correlation.Queries))
+	tags := make([]string, len(correlation.Queries))
+	for i, query := range correlation.Queries {
+		terms[i] = "(" + query + ")"
+		tags[i] = fmt.Sprintf("searchmatch(%s), %s", splString(query), splString(correlation.Rules[i]))
+	}
+	result := strings.Join(terms, " OR ")
+	if len(terms) == 1 {
+		result = correlation.Queries[0]
+	}
+
+	temporal := correlation.Type == sigma.Temporal || correlation.Type == sigma.TemporalOrdered
+	if temporal {
+		result += " | eval sigma_rule=case(" + strings.Join(tags, ", ") + ")"
+	}
+	if correlation.Type == sigma.TemporalOrdered {
+		// The events have to be in chronological order to check the order of the rules
+		result += " | sort 0 _time"
+	}
+
+	// Split the events into windows of the timespan, if there is one
+	var by []string
+	if correlation.Timespan != 0 {
+		result += " | bin _time span=" + formatTimeframe(correlation.Timespan)
+		by = append(by, "_time")
+	}
+	by = append(by, correlation.GroupBy...)
+	var groupedBy string
+	if len(by) > 0 {
+		groupedBy = " by " + strings.Join(by, " ")
+	}
+
+	condition := correlation.Condition
+	switch correlation.Type {
+	case sigma.EventCount:
+		result += " | stats count as value" + groupedBy
+
+	case sigma.ValueCount:
+		if condition.Field == "" {
+			return "", fmt.Errorf("value_count correlations require a field in the condition")
+		}
+		result += " | stats dc(" + condition.Field + ") as value" + groupedBy
+
+	case sigma.Temporal:
+		result += " | stats dc(sigma_rule) as value" + groupedBy
+
+	case sigma.TemporalOrdered:
+		// The rules have to appear in the order they are listed, with any other events in between
+		patterns := make([]string, len(correlation.Rules))
+		for i, rule := range correlation.Rules {
+			patterns[i] = regexp.QuoteMeta(rule)
+		}
+		pattern := "(^|,)" + strings.Join(patterns, ",(.*,)?") + "(,|$)"
+		return result + " | stats list(sigma_rule) as sigma_rules" + groupedBy +
+			" | where match(mvjoin(sigma_rules, \",\"), " + splString(pattern) + ")", nil
+
+	default:
+		return "", fmt.Errorf("unsupported correlation type %s", correlation.Type)
+	}
+
+	// Temporal correlations match if all rules matched, unless the condition says otherwise
+	if condition.Op == "" {
+		if !temporal {
+			return "", fmt.Errorf("%s correlations require a condition", correlation.Type)
+		}
+		condition.Op, condition.Threshold = sigma.GreaterThanEqual, float64(len(correlation.Rules))
+	}
+	return result + " | where value " + string(condition.Op) + " " + strconv.FormatFloat(condition.Threshold, 'f', -1, 64), nil
+}
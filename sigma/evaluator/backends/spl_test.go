@@ -0,0 +1,66 @@
+package backends
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mtnmunuklu/bridge/sigma"
+)
+
+func TestSPLAggregation(t *testing.T) {
+	tests := []struct {
+		name      string
+		function  sigma.AggregationFunc
+		timeframe time.Duration
+		expected  string
+	}{
+		{"count()", sigma.Count{}, 0, "| stats count as value | where value > 5"},
+		{"count() over 5m", sigma.Count{}, 5 * time.Minute, "| bin _time span=5m | stats count as value by _time | where value > 5"},
+		{"count() by host", sigma.Count{GroupedBy: "host"}, 0, "| stats count as value by host | where value > 5"},
+		{"count() by host over 5m", sigma.Count{GroupedBy: "host"}, 5 * time.Minute, "| bin _time span=5m | stats count as value by _time host | where value > 5"},
+		{"count(field)", sigma.Count{Field: "user"}, 0, "| stats dc(user) as value | where value > 5"},
+		{"count(field) over 5m", sigma.Count{Field: "user"}, 5 * time.Minute, "| bin _time span=5m | stats dc(user) as value by _time | where value > 5"},
+		{"count(field) by host", sigma.Count{Field: "user", GroupedBy: "host"}, 0, "| stats dc(user) as value by host | where value > 5"},
+		{"count(field) by host over 5m", sigma.Count{Field: "user", GroupedBy: "host"}, 5 * time.Minute, "| bin _time span=5m | stats dc(user) as value by _time host | where value > 5"},
+		{"avg", sigma.Average{Field: "bytes"}, 0, "| stats avg(bytes) as value | where value > 5"},
+		{"avg over 5m", sigma.Average{Field: "bytes"}, 5 * time.Minute, "| bin _time span=5m | stats avg(bytes) as value by _time | where value > 5"},
+		{"avg by host", sigma.Average{Field: "bytes", GroupedBy: "host"}, 0, "| stats avg(bytes) as value by host | where value > 5"},
+		{"avg by host over 5m", sigma.Average{Field: "bytes", GroupedBy: "host"}, 5 * time.Minute, "| bin _time span=5m | stats avg(bytes) as value by _time host | where value > 5"},
+		{"sum", sigma.Sum{Field: "bytes"}, 0, "| stats sum(bytes) as value | where value > 5"},
+		{"sum over 5m", sigma.Sum{Field: "bytes"}, 5 * time.Minute, "| bin _time span=5m | stats sum(bytes) as value by _time | where value > 5"},
+		{"sum by host", sigma.Sum{Field: "bytes", GroupedBy: "host"}, 0, "| stats sum(bytes) as value by host | where value > 5"},
+		{"sum by host over 5m", sigma.Sum{Field: "bytes", GroupedBy: "host"}, 5 * time.Minute, "| bin _time span=5m | stats sum(bytes) as value by _time host | where value > 5"},
+		{"min", sigma.Min{Field: "bytes"}, 0, "| stats min(bytes) as value | where value > 5"},
+		{"min over 5m", sigma.Min{Field: "bytes"}, 5 * time.Minute, "| bin _time span=5m | stats min(bytes) as value by _time | where value > 5"},
+		{"min by host", sigma.Min{Field: "bytes", GroupedBy: "host"}, 0, "| stats min(bytes) as value by host | where value > 5"},
+		{"min by host over 5m", sigma.Min{Field: "bytes", GroupedBy: "host"}, 5 * time.Minute, "| bin _time span=5m | stats min(bytes) as value by _time host | where value > 5"},
+		{"max", sigma.Max{Field: "bytes"}, 0, "| stats max(bytes) as value | where value > 5"},
+		{"max over 5m", sigma.Max{Field: "bytes"}, 5 * time.Minute, "| bin _time span=5m | stats max(bytes) as value by _time | where value > 5"},
+		{"max by host", sigma.Max{Field: "bytes", GroupedBy: "host"}, 0, "| stats max(bytes) as value by host | where value > 5"},
+		{"max by host over 5m", sigma.Max{Field: "bytes", GroupedBy: "host"}, 5 * time.Minute, "| bin _time span=5m | stats max(bytes) as value by _time host | where value > 5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := SPL{}.Aggregation(sigma.Comparison{Func: tt.function, Op: sigma.GreaterThan, Threshold: 5}, tt.timeframe)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestSPLAggregationOperators(t *testing.T) {
+	for _, op := range []sigma.ComparisonOp{sigma.Equal, sigma.NotEqual, sigma.LessThan, sigma.LessThanEqual, sigma.GreaterThan, sigma.GreaterThanEqual} {
+		result, err := SPL{}.Aggregation(sigma.Comparison{Func: sigma.Count{}, Op: op, Threshold: 2.5}, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if expected := "| stats count as value | where value " + string(op) + " 2.5"; result != expected {
+			t.Errorf("expected %q, got %q", expected, result)
+		}
+	}
+}
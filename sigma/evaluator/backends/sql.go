@@ -0,0 +1,231 @@
+package backends
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mtnmunuklu/bridge/sigma"
+)
+
+// SQLDialect is a dialect of SQL supported by the SQL backend
+type SQLDialect string
+
+// Supported SQL dialects
+const (
+	SQLite     SQLDialect = "sqlite"     // SQLite, whose REGEXP operator requires a user function or extension
+	PostgreSQL SQLDialect = "postgresql" // PostgreSQL
+)
+
+// SQL renders Sigma rules as SELECT statements over tables of normalized events.
+// The indexes of the config's logsource mappings are used as the table names.
+type SQL struct {
+	Dialect         SQLDialect // The dialect of the statements, SQLite if empty
+	TimestampColumn string     // The column of the event times that aggregations with a timeframe are bucketed by
+}
+
+// sqlAggregationSeparator separates the select list from the GROUP BY and HAVING clauses in a rendered aggregation.
+const sqlAggregationSeparator = "\n"
+
+// And joins the expressions with the AND operator.
+func (SQL) And(exprs []string) (string, error) {
+	return strings.Join(exprs, " AND "), nil
+}
+
+// Or joins the expressions with the OR operator.
+func (SQL) Or(exprs []string) (string, error) {
+	return strings.Join(exprs, " OR "), nil
+}
+
+// Not negates the expression with the NOT operator.
+func (SQL) Not(expr string) (string, error) {
+	return "NOT " + expr, nil
+}
+
+// Group wraps the expression in parentheses.
+func (SQL) Group(expr string) string {
+	return "(" + expr + ")"
+}
+
+// Keyword returns an error, the events are only stored as columns.
+func (SQL) Keyword(value string) (string, error) {
+	return "", fmt.Errorf("keyword searches are not supported by the sql backend")
+}
+
+// FieldMatch renders the comparison using LIKE patterns.
+// Case-insensitive comparisons use LIKE in SQLite and ILIKE in PostgreSQL, case sensitive ones use GLOB in SQLite and LIKE in PostgreSQL.
+func (backend SQL) FieldMatch(match FieldMatch) (string, error) {
+	field := backend.identifier(match.Field)
+
+	switch match.Comparator {
+	case "", "contains", "startswith", "endswith":
+		if match.Comparator == "" && match.Value == "null" {
+			return field + " IS NULL", nil
+		}
+
+		tokens := withComparator(parseValue(match.Value), match.Comparator)
+		literal, leading, trailing, ok := simpleValue(tokens)
+		exact := ok && !leading && !trailing
+		switch {
+		case exact && match.Comparator == "" && isNumber(literal):
+			return field + " = " + literal, nil
+		case exact && match.CaseSensitive:
+			return field + " = " + sqlString(literal), nil
+		case match.CaseSensitive && backend.Dialect != PostgreSQL:
+			return field + " GLOB " + sqlString(wildcardPattern(tokens, "*", "?", sqlEscapeGlob)), nil
+		case match.CaseSensitive:
+			return field + " LIKE " + sqlString(wildcardPattern(tokens, "%", "_", sqlEscapeLike)) + " ESCAPE '\\'", nil
+		case backend.Dialect == PostgreSQL:
+			return field + " ILIKE " + sqlString(wildcardPattern(tokens, "%", "_", sqlEscapeLike)) + " ESCAPE '\\'", nil
+		default:
+			return field + " LIKE " + sqlString(wildcardPattern(tokens, "%", "_", sqlEscapeLike)) + " ESCAPE '\\'", nil
+		}
+
+	case "re":
+		if backend.Dialect == PostgreSQL {
+			return field + " ~ " + sqlString(match.Value), nil
+		}
+		return field + " REGEXP " + sqlString(match.Value), nil
+
+	case "exists":
+		if match.Value == "true" {
+			return field + " IS NOT NULL", nil
+		}
+		return "(" + field + " IS NULL)", nil
+
+	case "cidr":
+		if backend.Dialect != PostgreSQL {
+			return "", fmt.Errorf("comparator cidr is not supported by the sqlite dialect")
+		}
+		return field + "::inet <<= " + sqlString(match.Value) + "::inet", nil
+
+	case "gt", "gte", "lt", "lte":
+		if !isNumber(match.Value) {
+			return "", fmt.Errorf("comparator %s expects a number, got %s", match.Comparator, match.Value)
+		}
+		return field + " " + comparisonOperators[match.Comparator] + " " + match.Value, nil
+
+	default:
+		return "", fmt.Errorf("comparator %s is not supported by the sql backend", match.Comparator)
+	}
+}
+
+// Aggregation renders the select list of the aggregation, followed by the GROUP BY and HAVING clauses.
+// If the rule has a timeframe, the events are grouped into buckets of the timeframe by the timestamp column,
+// which must be set as the tables have no common timestamp column.
+func (backend SQL) Aggregation(aggregation sigma.Comparison, timeframe time.Duration) (string, error) {
+	var function, groupedBy string
+	switch agg := aggregation.Func.(type) {
+	case sigma.Count:
+		function, groupedBy = "COUNT(*)", agg.GroupedBy
+		if agg.Field != "" {
+			// Counting a field counts its distinct values
+			function = "COUNT(DISTINCT " + backend.identifier(agg.Field) + ")"
+		}
+	case sigma.Average:
+		function, groupedBy = "AVG("+backend.identifier(agg.Field)+")", agg.GroupedBy
+	case sigma.Sum:
+		function, groupedBy = "SUM("+backend.identifier(agg.Field)+")", agg.GroupedBy
+	case sigma.Min:
+		function, groupedBy = "MIN("+backend.identifier(agg.Field)+")", agg.GroupedBy
+	case sigma.Max:
+		function, groupedBy = "MAX("+backend.identifier(agg.Field)+")", agg.GroupedBy
+	default:
+		return "", fmt.Errorf("unsupported aggregation function")
+	}
+
+	var selected, groups []string
+	if timeframe != 0 {
+		bucket, err := backend.timeBucket(timeframe)
+		if err != nil {
+			return "", err
+		}
+		selected, groups = append(selected, bucket+" AS timebucket"), append(groups, bucket)
+	}
+	if groupedBy != "" {
+		selected, groups = append(selected, backend.identifier(groupedBy)), append(groups, backend.identifier(groupedBy))
+	}
+
+	selectList := strings.Join(append(selected, function+" AS value"), ", ")
+	var clauses string
+	if len(groups) > 0 {
+		clauses = "GROUP BY " + strings.Join(groups, ", ") + " "
+	}
+	operator := string(aggregation.Op)
+	if aggregation.Op == sigma.NotEqual {
+		operator = "<>"
+	}
+	clauses += "HAVING " + function + " " + operator + " " + strconv.FormatFloat(aggregation.Threshold, 'f', -1, 64)
+
+	return selectList + sqlAggregationSeparator + clauses, nil
+}
+
+// Query renders a SELECT statement per table of the logsource, combined with UNION ALL.
+// The events of an aggregation are combined before they are grouped, so that they are aggregated across the tables.
+func (backend SQL) Query(query Query) (string, error) {
+	if len(query.Near) > 0 {
+		return "", fmt.Errorf("near is not supported by the sql backend")
+	}
+	if len(query.Indexes) == 0 {
+		return "", fmt.Errorf("no table found for logsource %s/%s/%s, set an index in the config", query.Logsource.Category, query.Logsource.Product, query.Logsource.Service)
+	}
+
+	statements := make([]string, len(query.Indexes))
+	for i, table := range query.Indexes {
+		statements[i] = "SELECT * FROM " + backend.identifier(table)
+		if query.Search != "" {
+			statements[i] += " WHERE " + query.Search
+		}
+	}
+	if query.Aggregation == "" {
+		return strings.Join(statements, " UNION ALL "), nil
+	}
+
+	selectList, clauses, _ := strings.Cut(query.Aggregation, sqlAggregationSeparator)
+	if len(statements) == 1 {
+		return "SELECT " + selectList + strings.TrimPrefix(statements[0], "SELECT *") + " " + clauses, nil
+	}
+	return "SELECT " + selectList + " FROM (" + strings.Join(statements, " UNION ALL ") + ") AS events " + clauses, nil
+}
+
+// timeBucket renders the number of the bucket of the timeframe that the timestamp column falls into, as the number of timeframes since the epoch.
+// SQLite timestamps must be in a format that its date and time functions take.
+func (backend SQL) timeBucket(timeframe time.Duration) (string, error) {
+	if backend.TimestampColumn == "" {
+		return "", fmt.Errorf("aggregations with a timeframe require a timestamp column in the sql backend")
+	}
+	seconds := strconv.FormatInt(int64((timeframe+time.Second-1)/time.Second), 10)
+	column := backend.identifier(backend.TimestampColumn)
+	if backend.Dialect == PostgreSQL {
+		return "FLOOR(EXTRACT(EPOCH FROM " + column + ") / " + seconds + ")", nil
+	}
+	return "CAST(strftime('%s', " + column + ") AS INTEGER) / " + seconds, nil
+}
+
+// identifier quotes an identifier if needed.
+// SQLite identifiers are case-insensitive, so they are only quoted if they contain special characters.
+// PostgreSQL folds unquoted identifiers to lower case, so they are also quoted if they contain upper case letters.
+func (backend SQL) identifier(name string) string {
+	for _, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' && backend.Dialect != PostgreSQL) {
+			return "\"" + strings.ReplaceAll(name, "\"", "\"\"") + "\""
+		}
+	}
+	return name
+}
+
+// sqlString quotes a value as an SQL string literal.
+func sqlString(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// sqlEscapeLike escapes the special characters of a LIKE pattern with backslashes.
+func sqlEscapeLike(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(value)
+}
+
+// sqlEscapeGlob escapes the special characters of a GLOB pattern with character classes.
+func sqlEscapeGlob(value string) string {
+	return strings.NewReplacer("*", "[*]", "?", "[?]", "[", "[[]").Replace(value)
+}
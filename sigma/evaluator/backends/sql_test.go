@@ -0,0 +1,65 @@
+package backends
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mtnmunuklu/bridge/sigma"
+)
+
+func TestSQLAggregationTimeframe(t *testing.T) {
+	tests := []struct {
+		name      string
+		backend   SQL
+		timeframe time.Duration
+		expected  string
+	}{
+		{"no timeframe", SQL{}, 0, "host, COUNT(*) AS value\nGROUP BY host HAVING COUNT(*) > 5"},
+		{"sqlite", SQL{TimestampColumn: "ts"}, 5 * time.Minute, "CAST(strftime('%s', ts) AS INTEGER) / 300 AS timebucket, host, COUNT(*) AS value\nGROUP BY CAST(strftime('%s', ts) AS INTEGER) / 300, host HAVING COUNT(*) > 5"},
+		{"postgresql", SQL{Dialect: PostgreSQL, TimestampColumn: "ts"}, 5 * time.Minute, "FLOOR(EXTRACT(EPOCH FROM ts) / 300) AS timebucket, host, COUNT(*) AS value\nGROUP BY FLOOR(EXTRACT(EPOCH FROM ts) / 300), host HAVING COUNT(*) > 5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.backend.Aggregation(sigma.Comparison{Func: sigma.Count{GroupedBy: "host"}, Op: sigma.GreaterThan, Threshold: 5}, tt.timeframe)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestSQLAggregationTimeframeRequiresTimestamp(t *testing.T) {
+	_, err := SQL{}.Aggregation(sigma.Comparison{Func: sigma.Count{}, Op: sigma.GreaterThan, Threshold: 5}, 5*time.Minute)
+	if err == nil {
+		t.Errorf("expected an error for a timeframe without a timestamp column")
+	}
+}
+
+func TestSQLQueryAggregation(t *testing.T) {
+	aggregation := "host, COUNT(*) AS value\nGROUP BY host HAVING COUNT(*) > 5"
+	tests := []struct {
+		name     string
+		indexes  []string
+		expected string
+	}{
+		{"one table", []string{"logons"}, "SELECT host, COUNT(*) AS value FROM logons WHERE EventID = 4625 GROUP BY host HAVING COUNT(*) > 5"},
+		// The events of the tables are counted together
+		{"several tables", []string{"logons", "archive"}, "SELECT host, COUNT(*) AS value FROM (SELECT * FROM logons WHERE EventID = 4625 UNION ALL SELECT * FROM archive WHERE EventID = 4625) AS events GROUP BY host HAVING COUNT(*) > 5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := SQL{}.Query(Query{Search: "EventID = 4625", Aggregation: aggregation, Indexes: tt.indexes})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
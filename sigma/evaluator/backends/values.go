@@ -0,0 +1,130 @@
+package backends
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// valueToken is a part of a Sigma value: either literal text or a single wildcard.
+type valueToken struct {
+	literal  string
+	wildcard rune // '*' or '?', zero for literal text
+}
+
+// parseValue splits a Sigma value into literal text and wildcards.
+// A backslash escapes a following wildcard or backslash, any other backslash is taken literally.
+func parseValue(value string) []valueToken {
+	var tokens []valueToken
+	var literal strings.Builder
+
+	runes := []rune(value)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '\\' && i+1 < len(runes) && (runes[i+1] == '*' || runes[i+1] == '?' || runes[i+1] == '\\'):
+			literal.WriteRune(runes[i+1])
+			i++
+		case r == '*' || r == '?':
+			if literal.Len() > 0 {
+				tokens = append(tokens, valueToken{literal: literal.String()})
+				literal.Reset()
+			}
+			tokens = append(tokens, valueToken{wildcard: r})
+		default:
+			literal.WriteRune(r)
+		}
+	}
+	if literal.Len() > 0 {
+		tokens = append(tokens, valueToken{literal: literal.String()})
+	}
+
+	return tokens
+}
+
+// withComparator applies a contains, startswith or endswith comparator to the tokens of a Sigma value by adding the matching wildcards.
+// The wildcards are added to the parsed tokens, so that a trailing backslash of the value can't escape them.
+func withComparator(tokens []valueToken, comparator string) []valueToken {
+	switch comparator {
+	case "contains":
+		return append(append([]valueToken{{wildcard: '*'}}, tokens...), valueToken{wildcard: '*'})
+	case "startswith":
+		return append(append([]valueToken{}, tokens...), valueToken{wildcard: '*'})
+	case "endswith":
+		return append([]valueToken{{wildcard: '*'}}, tokens...)
+	default:
+		return tokens
+	}
+}
+
+// simpleValue reports whether the tokens only have `*` wildcards at their start and/or end.
+// If so, it returns the literal text between them and whether there were leading or trailing wildcards.
+func simpleValue(tokens []valueToken) (literal string, leading, trailing, ok bool) {
+	for len(tokens) > 0 && tokens[0].wildcard == '*' {
+		tokens, leading = tokens[1:], true
+	}
+	for len(tokens) > 0 && tokens[len(tokens)-1].wildcard == '*' {
+		tokens, trailing = tokens[:len(tokens)-1], true
+	}
+	if len(tokens) > 1 || (len(tokens) == 1 && tokens[0].wildcard != 0) {
+		return "", false, false, false
+	}
+	if len(tokens) == 1 {
+		literal = tokens[0].literal
+	}
+	return literal, leading, trailing, true
+}
+
+// wildcardPattern converts the tokens into a pattern of the target language.
+// Literal text is passed through the escape function, and the wildcards are replaced with the given strings.
+func wildcardPattern(tokens []valueToken, many, one string, escape func(string) string) string {
+	var builder strings.Builder
+	for _, token := range tokens {
+		switch token.wildcard {
+		case '*':
+			builder.WriteString(many)
+		case '?':
+			builder.WriteString(one)
+		default:
+			builder.WriteString(escape(token.literal))
+		}
+	}
+	return builder.String()
+}
+
+// regexPattern converts the tokens into an anchored regular expression.
+func regexPattern(tokens []valueToken) string {
+	return "^" + wildcardPattern(tokens, ".*", ".", regexp.QuoteMeta) + "$"
+}
+
+// inlineFlags matches the inline flag group that the flags of the re modifier add to the start of a regular expression
+var inlineFlags = regexp.MustCompile(`^\(\?([a-z]+)\)`)
+
+// regexFlags splits a regular expression into its inline flags (e.g. "i" for "(?i)") and the rest of the expression.
+func regexFlags(pattern string) (string, string) {
+	if match := inlineFlags.FindStringSubmatch(pattern); match != nil {
+		return match[1], pattern[len(match[0]):]
+	}
+	return "", pattern
+}
+
+// isNumber reports whether the value is a decimal number.
+func isNumber(value string) bool {
+	_, err := strconv.ParseFloat(value, 64)
+	return err == nil && strings.TrimSpace(value) == value
+}
+
+// formatTimeframe formats a duration using the largest whole unit out of days, hours, minutes and seconds, e.g. "5m".
+func formatTimeframe(timeframe time.Duration) string {
+	switch {
+	case timeframe%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", timeframe/(24*time.Hour))
+	case timeframe%time.Hour == 0:
+		return fmt.Sprintf("%dh", timeframe/time.Hour)
+	case timeframe%time.Minute == 0:
+		return fmt.Sprintf("%dm", timeframe/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", timeframe/time.Second)
+	}
+}
@@ -0,0 +1,58 @@
+package backends
+
+import "testing"
+
+// Windows paths often end with a backslash, which must not escape the wildcards that the comparators add
+func TestTrailingBackslash(t *testing.T) {
+	tests := []struct {
+		name       string
+		backend    Backend
+		comparator string
+		expected   string
+	}{
+		{"kql contains", KQL{}, "contains", `Image contains "\\AppData\\Local\\Temp\\"`},
+		{"kql startswith", KQL{}, "startswith", `Image startswith "\\AppData\\Local\\Temp\\"`},
+		{"kql endswith", KQL{}, "endswith", `Image endswith "\\AppData\\Local\\Temp\\"`},
+		{"lucene contains", Lucene{}, "contains", `Image:*\\AppData\\Local\\Temp\\*`},
+		{"lucene startswith", Lucene{}, "startswith", `Image:\\AppData\\Local\\Temp\\*`},
+		{"lucene endswith", Lucene{}, "endswith", `Image:*\\AppData\\Local\\Temp\\`},
+		{"aql contains", AQL{}, "contains", `Image ILIKE '%\\AppData\\Local\\Temp\\%' ESCAPE '\'`},
+		{"aql startswith", AQL{}, "startswith", `Image ILIKE '\\AppData\\Local\\Temp\\%' ESCAPE '\'`},
+		{"aql endswith", AQL{}, "endswith", `Image ILIKE '%\\AppData\\Local\\Temp\\' ESCAPE '\'`},
+		{"sql contains", SQL{}, "contains", `Image LIKE '%\\AppData\\Local\\Temp\\%' ESCAPE '\'`},
+		{"sql startswith", SQL{}, "startswith", `Image LIKE '\\AppData\\Local\\Temp\\%' ESCAPE '\'`},
+		{"sql endswith", SQL{}, "endswith", `Image LIKE '%\\AppData\\Local\\Temp\\' ESCAPE '\'`},
+		{"logql contains", LogQL{}, "contains", `Image=~"(?i).*\\\\AppData\\\\Local\\\\Temp\\\\.*"`},
+		{"logql startswith", LogQL{}, "startswith", `Image=~"(?i)\\\\AppData\\\\Local\\\\Temp\\\\.*"`},
+		{"logql endswith", LogQL{}, "endswith", `Image=~"(?i).*\\\\AppData\\\\Local\\\\Temp\\\\"`},
+		{"eql contains", EQL{}, "contains", `Image : "*\\\\AppData\\\\Local\\\\Temp\\\\*"`},
+		{"eql startswith", EQL{}, "startswith", `Image : "\\\\AppData\\\\Local\\\\Temp\\\\*"`},
+		{"eql endswith", EQL{}, "endswith", `Image : "*\\\\AppData\\\\Local\\\\Temp\\\\"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.backend.FieldMatch(FieldMatch{Field: "Image", Comparator: tt.comparator, Value: `\AppData\Local\Temp\`})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestWithComparator(t *testing.T) {
+	// The trailing backslash is literal text, followed by the wildcard of the comparator
+	tokens := withComparator(parseValue(`C:\Temp\`), "contains")
+	expected := []valueToken{{wildcard: '*'}, {literal: `C:\Temp\`}, {wildcard: '*'}}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, tokens)
+	}
+	for i := range expected {
+		if tokens[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, tokens)
+		}
+	}
+}
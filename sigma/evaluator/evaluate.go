@@ -1,10 +1,11 @@
 package evaluator
 
 import (
+	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/mtnmunuklu/bridge/sigma"
+	"github.com/mtnmunuklu/bridge/sigma/evaluator/backends"
 )
 
 type RuleEvaluator struct {
@@ -13,96 +14,177 @@ type RuleEvaluator struct {
 	indexes         []string            // The list of indexes that this rule should be applied to. Computed from the Logsource field in the rule and any config that's supplied.
 	indexConditions []sigma.Search      // Any field-value conditions that need to match for this rule to apply to events from []indexes
 	fieldmappings   map[string][]string // A compiled mapping from rule fieldnames to possible event fieldnames
+	backend         backends.Backend    // The backend that renders the rule into the target query language
 
-	expandPlaceholder func(placeholderName string) ([]string, error) // A function to expand placeholders in the Sigma rule template
-	caseSensitive     bool
+	expandPlaceholder      func(placeholderName string) ([]string, error) // A function to expand placeholders in the Sigma rule template
+	unresolvedPlaceholders UnresolvedPlaceholders                         // How placeholders without values are handled
+	caseSensitive          bool
 }
 
 // ForRule constructs a new RuleEvaluator with the given Sigma rule and evaluation options.
 // It applies any provided options to the new RuleEvaluator and returns it.
+// Unless another backend is selected with WithBackend, the rule is rendered as SPL.
+// Unless another placeholder expander is set with WithPlaceholderExpander, placeholders are expanded into the values defined by the configs.
 func ForRule(rule sigma.Rule, options ...Option) *RuleEvaluator {
-	e := &RuleEvaluator{Rule: rule}
+	e := &RuleEvaluator{Rule: rule, backend: backends.SPL{}, unresolvedPlaceholders: UnresolvedError}
 	for _, option := range options {
 		option(e)
 	}
+	if e.expandPlaceholder == nil {
+		e.expandPlaceholder = PlaceholderExpander(ConfigPlaceholders(e.config...))
+	}
 	return e
 }
 
 // Result represents the evaluation result of a Sigma rule.
 // It contains the search, condition, aggregation, and query results of the rule evaluation.
 type Result struct {
-	SearchResults      map[string][]string // The map of search identifiers to their result values
-	ConditionResults   map[int][]string    // The map of condition indices to their result values
-	AggregationResults map[int]string      // The map of aggregation indices to their result values
-	QueryResults       map[int]string      // The map of query indices to their result values
+	SearchQueries      map[string]string // The map of search identifiers to their rendered search expressions
+	ConditionQueries   map[int]string    // The map of condition indices to their rendered search expressions
+	AggregationResults map[int]string    // The map of aggregation indices to their result values
+	QueryResults       map[int]string    // The map of query indices to their result values
+
+	// Deprecated: SearchResults holds the rendered expression of each search as its only value, use SearchQueries instead.
+	SearchResults map[string][]string
+	// Deprecated: ConditionResults holds the rendered expression of each condition as its only value, use ConditionQueries instead.
+	ConditionResults map[int][]string
 }
 
 // This function returns a Result object containing the evaluation results for the rule's Detection field.
-// It uses the evaluateSearch, evaluateSearchExpression and evaluateAggregationExpression functions to compute the results.
+// It uses the evaluateSearch, evaluateSearchExpression and evaluateAggregationExpression functions to compute the results,
+// and the configured backend to assemble them into the final queries.
+// If the backend can't render some field matches as part of a search, the conditions that refer to those searches
+// are rendered with its filter backend instead.
 func (rule RuleEvaluator) Bridges() (Result, error) {
+	return rule.bridges(true)
+}
+
+// bridges renders the rule with its backend.
+// If filterFallback is set, a condition whose searches the backend can't render is rendered with the filter backend of the backend.
+// Otherwise the condition fails with ErrFilterRequired.
+func (rule RuleEvaluator) bridges(filterFallback bool) (Result, error) {
 	result := Result{
-		SearchResults:      make(map[string][]string),
-		ConditionResults:   make(map[int][]string),
+		SearchQueries:      make(map[string]string),
+		ConditionQueries:   make(map[int]string),
 		AggregationResults: make(map[int]string),
 		QueryResults:       make(map[int]string),
+		SearchResults:      make(map[string][]string),
+		ConditionResults:   make(map[int][]string),
 	}
+	filterRule, filterErr := rule.withFilterBackend()
 
-	// Evaluate all the search expressions in the Detection field and store the results in the SearchResults map of the result object.
+	// Evaluate all the searches in the Detection field and store the results in the SearchQueries map of the result object.
+	// Searches that the backend can't render are stored as rendered by the filter backend.
 	for identifier, search := range rule.Detection.Searches {
-		var err error
-		result.SearchResults[identifier], err = rule.evaluateSearch(search)
+		query, err := rule.evaluateSearch(search, false)
+		if errors.Is(err, backends.ErrFilterRequired) && filterErr == nil {
+			query, err = filterRule.evaluateSearch(search, false)
+		}
 		if err != nil {
 			return Result{}, fmt.Errorf("error evaluating search %s: %w", identifier, err)
 		}
+		result.SearchQueries[identifier] = query.query
+		result.SearchResults[identifier] = []string{query.query}
 	}
 
-	// Evaluate all the search expressions in the Detection field's Conditions array and store the results in the ConditionResults map of the result object.
+	// Evaluate all the search expressions in the Detection field's Conditions array and store the results in the ConditionQueries map of the result object.
 	// If a condition has an Aggregation field, also evaluate it and store the result in the AggregationResults map of the result object.
 	for conditionIndex, condition := range rule.Detection.Conditions {
-		result.ConditionResults[conditionIndex] = rule.evaluateSearchExpression(condition.Search, []string{}, true)
-		if condition.Aggregation != nil {
-			var err error
-			result.AggregationResults[conditionIndex], err = rule.evaluateAggregationExpression(condition.Aggregation)
-			if err != nil {
-				return Result{}, err
+		err := rule.bridgeCondition(conditionIndex, condition, &result)
+		if filterFallback && errors.Is(err, backends.ErrFilterRequired) {
+			if filterErr != nil {
+				return Result{}, fmt.Errorf("%w, and %w", err, filterErr)
 			}
+			err = filterRule.bridgeCondition(conditionIndex, condition, &result)
+		}
+		if err != nil {
+			return Result{}, err
 		}
 	}
 
-	// Combine the search results and condition results to form the final query strings for each condition.
-	// The query strings are stored in the QueryResults map of the result object.
-	for i, conditionResult := range result.ConditionResults {
-		conditionList := make([]string, 0, len(conditionResult))
-		for _, condition := range conditionResult {
-			// If the condition matches any search identifier, replace it with the corresponding search results
-			if value, ok := result.SearchResults[condition]; ok {
-				if len(conditionResult) > 1 && len(value) > 1 {
-					conditionList = append(conditionList, "("+strings.Join(value, " ")+")")
-				} else if len(value) > 1 {
-					conditionList = append(conditionList, strings.Join(value, " "))
-				} else {
-					conditionList = append(conditionList, strings.Join(value, ""))
-				}
-			} else {
-				// If the condition doesn't match any search identifier, add it as is to the conditionList
-				conditionList = append(conditionList, condition)
+	return result, nil
+}
+
+// withFilterBackend returns a copy of the rule evaluator that renders the rule with the filter backend of its backend.
+func (rule RuleEvaluator) withFilterBackend() (RuleEvaluator, error) {
+	filterer, ok := rule.backend.(backends.Filterer)
+	if !ok {
+		return rule, fmt.Errorf("the backend can't render filters")
+	}
+	backend, err := filterer.Filter()
+	if err != nil {
+		return rule, err
+	}
+	rule.backend = backend
+	return rule, nil
+}
+
+// bridgeCondition renders the condition with the searches it refers to, and stores the results under the index of the condition.
+func (rule RuleEvaluator) bridgeCondition(conditionIndex int, condition sigma.Condition, result *Result) error {
+	expressions := []sigma.SearchExpr{condition.Search}
+	nearAggregation, isNear := condition.Aggregation.(sigma.Near)
+	if isNear {
+		expressions = append(expressions, nearAggregation.Condition)
+	}
+
+	// Only the searches that the condition refers to are rendered, so that the other searches can't affect its rendering
+	searchResults := make(map[string]expression)
+	for _, expr := range expressions {
+		for _, identifier := range rule.referencedSearches(expr) {
+			if _, ok := searchResults[identifier]; ok {
+				continue
+			}
+			search, ok := rule.Detection.Searches[identifier]
+			if !ok {
+				continue
+			}
+			var err error
+			searchResults[identifier], err = rule.evaluateSearch(search, false)
+			if err != nil {
+				return fmt.Errorf("error evaluating search %s: %w", identifier, err)
 			}
 		}
+	}
 
-		result.QueryResults[i] = strings.Join(conditionList, "")
+	search, err := rule.evaluateSearchExpression(condition.Search, searchResults, false)
+	if err != nil {
+		return err
+	}
 
-		// If the condition has an aggregation, add the aggregation to the final query string
-		if result.AggregationResults[i] != "" {
-			result.QueryResults[i] += " " + result.AggregationResults[i]
+	// A near aggregation is made up of further searches that the backend combines with the condition's search
+	var near []string
+	var aggregation string
+	if isNear {
+		near, err = rule.evaluateNear(nearAggregation, searchResults)
+		if err != nil {
+			return err
 		}
-
-		// Add the sourcetype condition to the final query string, if applicable
-		if rule.Logsource.Product != "" && rule.Logsource.Service != "" {
-			result.QueryResults[i] = fmt.Sprintf("sourcetype=\"%v\" %v", rule.Logsource.Product+"-"+rule.Logsource.Service, result.QueryResults[i])
-		} else if rule.Logsource.Product != "" && rule.Logsource.Service == "" {
-			result.QueryResults[i] = fmt.Sprintf("sourcetype=\"%v\" %v", rule.Logsource.Product+"-*", result.QueryResults[i])
+	} else if condition.Aggregation != nil {
+		aggregation, err = rule.evaluateAggregationExpression(condition.Aggregation)
+		if err != nil {
+			return err
 		}
 	}
 
-	return result, nil
+	// Combine the search and aggregation results with the logsource to form the final query string for the condition.
+	query, err := rule.backend.Query(backends.Query{
+		Search:      search.query,
+		Aggregation: aggregation,
+		Logsource:   rule.Logsource,
+		Indexes:     rule.indexes,
+		Near:        near,
+		Timeframe:   rule.Detection.Timeframe,
+		Lookups:     rule.lookups(),
+	})
+	if err != nil {
+		return err
+	}
+
+	result.ConditionQueries[conditionIndex] = search.query
+	result.ConditionResults[conditionIndex] = []string{search.query}
+	if aggregation != "" {
+		result.AggregationResults[conditionIndex] = aggregation
+	}
+	result.QueryResults[conditionIndex] = query
+	return nil
 }
@@ -0,0 +1,96 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/mtnmunuklu/bridge/sigma"
+	"github.com/mtnmunuklu/bridge/sigma/evaluator/backends"
+)
+
+// CorrelationEvaluator renders a Sigma correlation rule by combining the queries of the rules it references.
+type CorrelationEvaluator struct {
+	sigma.Correlation
+	options []Option // The options that the referenced rules are evaluated with
+}
+
+// ForCorrelation constructs a new CorrelationEvaluator with the given Sigma correlation rule and evaluation options.
+// The referenced rules must have been resolved, and are evaluated with the same options.
+func ForCorrelation(correlation sigma.Correlation, options ...Option) *CorrelationEvaluator {
+	return &CorrelationEvaluator{Correlation: correlation, options: options}
+}
+
+// Bridges renders the correlation rule as a single query of the backend.
+// The referenced rules are rendered as usual, and the backend correlates the events they match.
+func (correlation CorrelationEvaluator) Bridges() (string, error) {
+	if len(correlation.Rules) == 0 {
+		return "", fmt.Errorf("correlation %s doesn't reference any rules", correlation.Title)
+	}
+
+	detection := correlation.Correlation.Correlation
+	result := backends.Correlation{
+		Type:      detection.Type,
+		Rules:     detection.Rules,
+		Timespan:  detection.Timespan,
+		Condition: detection.Condition,
+	}
+
+	var rule *RuleEvaluator
+	for i, referenced := range correlation.Rules {
+		rule = ForRule(referenced, correlation.options...)
+		query, err := rule.bridgeCorrelated()
+		if err != nil {
+			return "", fmt.Errorf("error evaluating rule %s: %w", result.Rules[i], err)
+		}
+		result.Queries = append(result.Queries, query)
+	}
+
+	correlator, ok := rule.backend.(backends.Correlator)
+	if !ok {
+		return "", fmt.Errorf("correlation rules are not supported by the backend")
+	}
+
+	// Map the fields of the correlation to the event fieldnames
+	for _, field := range detection.GroupBy {
+		result.GroupBy = append(result.GroupBy, rule.mapField(field))
+	}
+	if result.Condition.Field != "" {
+		result.Condition.Field = rule.mapField(result.Condition.Field)
+	}
+
+	return correlator.Correlation(result)
+}
+
+// bridgeCorrelated renders the rule as a single query whose events can be correlated.
+// The queries of a rule with several conditions are ORed together, so they must be searches rather than pipelines
+// of commands, which rules rendered with the filter backend and rules with near conditions would be.
+func (rule RuleEvaluator) bridgeCorrelated() (string, error) {
+	for _, condition := range rule.Detection.Conditions {
+		if _, ok := condition.Aggregation.(sigma.Near); ok {
+			return "", fmt.Errorf("rules with near conditions can't be correlated")
+		}
+	}
+	result, err := rule.bridges(false)
+	if errors.Is(err, backends.ErrFilterRequired) {
+		return "", fmt.Errorf("rules that can only be rendered as filters, such as rules with regular expressions, can't be correlated")
+	} else if err != nil {
+		return "", err
+	}
+	if len(result.AggregationResults) > 0 {
+		return "", fmt.Errorf("rules with aggregations can't be correlated")
+	}
+
+	indices := make([]int, 0, len(result.QueryResults))
+	for index := range result.QueryResults {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+
+	queries := make([]expression, len(indices))
+	for i, index := range indices {
+		queries[i] = expression{query: result.QueryResults[index], compound: true}
+	}
+	query, err := rule.combine(rule.backend.Or, queries)
+	return query.query, err
+}
@@ -1,256 +1,384 @@
 package evaluator
 
 import (
+	"errors"
 	"fmt"
+	"net/netip"
 	"path"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/mtnmunuklu/bridge/sigma"
+	"github.com/mtnmunuklu/bridge/sigma/evaluator/backends"
 	"github.com/mtnmunuklu/bridge/sigma/evaluator/modifiers"
 )
 
-// evaluateSearchExpression evaluates a Sigma search expression recursively and returns a string representation of the search condition.
-func (rule RuleEvaluator) evaluateSearchExpression(search sigma.SearchExpr, conditionResult []string, isTopLevel bool) []string {
+// expression is a rendered search expression.
+// Compound expressions consist of more than one term and have to be grouped when they are nested in another expression.
+type expression struct {
+	query    string
+	compound bool
+}
+
+// evaluateSearchExpression evaluates a Sigma search expression recursively and returns its rendered representation.
+// The searchResults map holds the rendered searches of the rule by their identifier.
+// If negated is set, the negation of the expression is rendered. This is only the case for backends that implement
+// backends.NegationPusher, all other backends negate expressions with their Not operation.
+func (rule RuleEvaluator) evaluateSearchExpression(search sigma.SearchExpr, searchResults map[string]expression, negated bool) (expression, error) {
 	// evaluate search expressions using a switch statement
 	switch s := search.(type) {
 	// if the search is an 'and' operation
 	case sigma.And:
-		// if not top level and more than 1 condition, add '(' to conditionResult
-		if !isTopLevel && len(s) > 1 {
-			conditionResult = append(conditionResult, "(")
-		}
-		// iterate through the conditions and add 'and' between them
-		for i, node := range s {
-			if i > 0 {
-				conditionResult = append(conditionResult, " ")
-			}
-			// evaluate the nested search expression
-			conditionResult = rule.evaluateSearchExpression(node, conditionResult, false)
+		operands, err := rule.evaluateOperands(s, searchResults, negated)
+		if err != nil {
+			return expression{}, err
 		}
-		// if not top level and more than 1 condition, add ')' to conditionResult
-		if !isTopLevel && len(s) > 1 {
-			conditionResult = append(conditionResult, ")")
-		}
-		return conditionResult
+		return rule.combine(rule.and(negated), operands)
 
 	// if the search is an 'or' operation
 	case sigma.Or:
-		// if not top level and more than 1 condition, add '(' to conditionResult
-		if !isTopLevel && len(s) > 1 {
-			conditionResult = append(conditionResult, "(")
-		}
-		// iterate through the conditions and add 'or' between them
-		for i, node := range s {
-			if i > 0 {
-				conditionResult = append(conditionResult, " OR ")
-			}
-			// evaluate the nested search expression
-			conditionResult = rule.evaluateSearchExpression(node, conditionResult, false)
-		}
-		// if not top level and more than 1 condition, add ')' to conditionResult
-		if !isTopLevel && len(s) > 1 {
-			conditionResult = append(conditionResult, ")")
+		operands, err := rule.evaluateOperands(s, searchResults, negated)
+		if err != nil {
+			return expression{}, err
 		}
-		return conditionResult
+		return rule.combine(rule.or(negated), operands)
 
 	// if the search is a 'not' operation
 	case sigma.Not:
-		// add 'not' to conditionResult
-		conditionResult = append(conditionResult, "NOT ")
-		// evaluate the nested search expression
-		conditionResult = rule.evaluateSearchExpression(s.Expr, conditionResult, false)
-		return conditionResult
+		// If the backend can't negate expressions, push the negation down to the field matches
+		if _, ok := rule.backend.(backends.NegationPusher); ok {
+			return rule.evaluateSearchExpression(s.Expr, searchResults, !negated)
+		}
+
+		// evaluate the nested search expression and negate it
+		operand, err := rule.evaluateSearchExpression(s.Expr, searchResults, false)
+		if err != nil {
+			return expression{}, err
+		}
+		query, err := rule.backend.Not(rule.group(operand))
+		return expression{query: query}, err
 
 	// if the search is an identifier
 	case sigma.SearchIdentifier:
-		// add the identifier name to conditionResult
-		conditionResult = append(conditionResult, s.Name)
-		return conditionResult
-
-	// if the search is 'one of them'
-	case sigma.OneOfThem:
-		// if the number of searches is greater than 1, add "("
-		if !isTopLevel && len(rule.Detection.Searches) > 1 {
-			conditionResult = append(conditionResult, "(")
-		}
-		// iterate through all the search expressions and add 'or' between them
-		for name := range rule.Detection.Searches {
-			// If the search expression name matches the pattern, and it's not the first one, and the last element is not " ", " OR ", or "(", then add " OR " to the condition result
-			if len(conditionResult) > 0 {
-				lastElement := conditionResult[len(conditionResult)-1]
-				if lastElement != " " && lastElement != " OR " && lastElement != "(" {
-					conditionResult = append(conditionResult, " OR ")
+		if negated {
+			if search, ok := rule.Detection.Searches[s.Name]; ok {
+				result, err := rule.evaluateSearch(search, true)
+				if err != nil {
+					return expression{}, fmt.Errorf("error evaluating search %s: %w", s.Name, err)
 				}
+				return result, nil
 			}
-			// evaluate the nested search expression
-			conditionResult = rule.evaluateSearchExpression(sigma.SearchIdentifier{Name: name}, conditionResult, false)
 		}
-		// if the number of searches is greater than 1, add ")"
-		if !isTopLevel && len(rule.Detection.Searches) > 1 {
-			conditionResult = append(conditionResult, ")")
+		// replace the identifier with the corresponding search result
+		if result, ok := searchResults[s.Name]; ok {
+			return result, nil
 		}
-		return conditionResult
+		return expression{}, fmt.Errorf("undefined search identifier %s", s.Name)
+
+	// if the search is 'one of them'
+	case sigma.OneOfThem:
+		return rule.evaluateSearchExpression(sigma.Or(rule.matchingSearches("*")), searchResults, negated)
 
 	case sigma.OneOfPattern:
-		var matchingSearches []string
-		// Iterate over the search expressions in the rule's searches
-		for name := range rule.Detection.Searches {
-			// Check if the search expression name matches the pattern
-			matchesPattern, _ := path.Match(s.Pattern, name)
-			if matchesPattern {
-				// If the search expression name matches the pattern, add it to the matchingSearches slice
-				matchingSearches = append(matchingSearches, name)
-			}
-		}
+		return rule.evaluateSearchExpression(sigma.Or(rule.matchingSearches(s.Pattern)), searchResults, negated)
 
-		numMatchingSearches := len(matchingSearches)
-		// If there are more than one matching search expressions, add an opening parenthesis to the condition result
-		if !isTopLevel && numMatchingSearches > 1 {
-			conditionResult = append(conditionResult, "(")
-		}
+	case sigma.OneOfIdentifier:
+		return rule.evaluateSearchExpression(s.Ident, searchResults, negated)
 
-		// Iterate over the matching search expressions
-		for i, name := range matchingSearches {
-			if i > 0 {
-				lastElement := conditionResult[len(conditionResult)-1]
-				// If the last element in the condition result is not " ", " OR ", or "(", add " OR " to the condition result
-				if lastElement != " " && lastElement != " OR " && lastElement != "(" {
-					conditionResult = append(conditionResult, " OR ")
-				}
-			}
-			// Evaluate the search expression and append its result to the condition result
-			conditionResult = rule.evaluateSearchExpression(sigma.SearchIdentifier{Name: name}, conditionResult, false)
-		}
+	case sigma.AllOfThem:
+		return rule.evaluateSearchExpression(sigma.And(rule.matchingSearches("*")), searchResults, negated)
 
-		// If there are more than one matching search expressions, add a closing parenthesis to the condition result
-		if !isTopLevel && numMatchingSearches > 1 {
-			conditionResult = append(conditionResult, ")")
-		}
+	case sigma.AllOfPattern:
+		return rule.evaluateSearchExpression(sigma.And(rule.matchingSearches(s.Pattern)), searchResults, negated)
 
-		return conditionResult
+	case sigma.AllOfIdentifier:
+		return rule.evaluateSearchExpression(s.Ident, searchResults, negated)
+	}
+	return expression{}, fmt.Errorf("unhandled node type %T", search)
+}
 
-	case sigma.AllOfThem:
-		// if the number of searches is greater than 1, add "("
-		if !isTopLevel && len(rule.Detection.Searches) > 1 {
-			conditionResult = append(conditionResult, "(")
-		}
-		// iterate over all search expressions in the rule's searches
-		for name := range rule.Detection.Searches {
-			// If the search expression name matches the pattern, and it's not the first one, and the last element is not " ", " OR ", or "(", then add " OR " to the condition result
-			if len(conditionResult) > 0 {
-				lastElement := conditionResult[len(conditionResult)-1]
-				if lastElement != " " && lastElement != " OR " && lastElement != "(" {
-					conditionResult = append(conditionResult, " ")
-				}
-			}
-			// recursively evaluate the search expression and append its result to the condition result
-			conditionResult = rule.evaluateSearchExpression(sigma.SearchIdentifier{Name: name}, conditionResult, false)
+// evaluateOperands evaluates the operands of an 'and' or 'or' operation.
+func (rule RuleEvaluator) evaluateOperands(searches []sigma.SearchExpr, searchResults map[string]expression, negated bool) ([]expression, error) {
+	operands := make([]expression, 0, len(searches))
+	for _, node := range searches {
+		// evaluate the nested search expression
+		operand, err := rule.evaluateSearchExpression(node, searchResults, negated)
+		if err != nil {
+			return nil, err
 		}
-		// if the number of searches is greater than 1, add ")"
-		if !isTopLevel && len(rule.Detection.Searches) > 1 {
-			conditionResult = append(conditionResult, ")")
+		operands = append(operands, operand)
+	}
+	return operands, nil
+}
+
+// and returns the backend operation that joins expressions that must all match.
+// When a negation is pushed down, the operands are negated as well, so they are joined with 'or' instead.
+func (rule RuleEvaluator) and(negated bool) func([]string) (string, error) {
+	if negated {
+		return rule.backend.Or
+	}
+	return rule.backend.And
+}
+
+// or returns the backend operation that joins expressions of which at least one must match.
+// When a negation is pushed down, the operands are negated as well, so they are joined with 'and' instead.
+func (rule RuleEvaluator) or(negated bool) func([]string) (string, error) {
+	if negated {
+		return rule.backend.And
+	}
+	return rule.backend.Or
+}
+
+// matchingSearches returns the identifiers of the rule's searches whose name matches the pattern, in a stable order.
+func (rule RuleEvaluator) matchingSearches(pattern string) []sigma.SearchExpr {
+	var names []string
+	// Iterate over the search expressions in the rule's searches
+	for name := range rule.Detection.Searches {
+		// Check if the search expression name matches the pattern
+		if matchesPattern, _ := path.Match(pattern, name); matchesPattern {
+			names = append(names, name)
 		}
-		return conditionResult
+	}
+	sort.Strings(names)
 
+	identifiers := make([]sigma.SearchExpr, len(names))
+	for i, name := range names {
+		identifiers[i] = sigma.SearchIdentifier{Name: name}
+	}
+	return identifiers
+}
+
+// referencedSearches returns the names of the searches that the search expression refers to,
+// either by their identifier or by the patterns they match.
+func (rule RuleEvaluator) referencedSearches(search sigma.SearchExpr) []string {
+	var operands []sigma.SearchExpr
+	switch s := search.(type) {
+	case sigma.And:
+		operands = s
+	case sigma.Or:
+		operands = s
+	case sigma.Not:
+		operands = []sigma.SearchExpr{s.Expr}
+	case sigma.SearchIdentifier:
+		return []string{s.Name}
+	case sigma.OneOfIdentifier:
+		return []string{s.Ident.Name}
+	case sigma.AllOfIdentifier:
+		return []string{s.Ident.Name}
+	case sigma.OneOfThem, sigma.AllOfThem:
+		operands = rule.matchingSearches("*")
+	case sigma.OneOfPattern:
+		operands = rule.matchingSearches(s.Pattern)
 	case sigma.AllOfPattern:
-		var matchingSearches []string
-		// Iterate over the search expressions in the rule's searches
-		for name := range rule.Detection.Searches {
-			// Check if the search expression name matches the pattern
-			matchesPattern, _ := path.Match(s.Pattern, name)
-			if matchesPattern {
-				// If the search expression name matches the pattern, add it to the matchingSearches slice
-				matchingSearches = append(matchingSearches, name)
+		operands = rule.matchingSearches(s.Pattern)
+	}
+
+	var names []string
+	for _, operand := range operands {
+		names = append(names, rule.referencedSearches(operand)...)
+	}
+	return names
+}
+
+// combine joins the operands using the given backend operation.
+// If there is more than one operand, compound operands are grouped to keep operator precedence.
+func (rule RuleEvaluator) combine(operation func([]string) (string, error), operands []expression) (expression, error) {
+	if len(operands) == 1 {
+		return operands[0], nil
+	}
+
+	queries := make([]string, len(operands))
+	for i, operand := range operands {
+		queries[i] = rule.group(operand)
+	}
+
+	query, err := operation(queries)
+	return expression{query: query, compound: len(operands) > 1}, err
+}
+
+// group returns the query of the expression, grouped by the backend if the expression is compound.
+func (rule RuleEvaluator) group(e expression) string {
+	if e.compound {
+		return rule.backend.Group(e.query)
+	}
+	return e.query
+}
+
+// evaluateSearch renders a single search of the rule, or its negation if negated is set.
+// Keywords are ORed together, the field matchers of an event matcher are ANDed and a list of event matchers is ORed.
+func (rule RuleEvaluator) evaluateSearch(search sigma.Search, negated bool) (expression, error) {
+	if len(search.Keywords) > 0 {
+		keywords := make([]expression, len(search.Keywords))
+		for i, keyword := range search.Keywords {
+			var query string
+			var err error
+			if negated {
+				query, err = rule.backend.(backends.NegationPusher).NotKeyword(keyword)
+			} else {
+				query, err = rule.backend.Keyword(keyword)
+			}
+			if err != nil {
+				return expression{}, err
 			}
+			keywords[i] = expression{query: query}
 		}
 
-		numMatchingSearches := len(matchingSearches)
-		// If there are more than one matching search expressions, add an opening parenthesis to the condition result
-		if !isTopLevel && numMatchingSearches > 1 {
-			conditionResult = append(conditionResult, "(")
-		}
+		// A list of keywords is always grouped, so that it behaves as a single term
+		result, err := rule.combine(rule.or(negated), keywords)
+		return expression{query: rule.group(result)}, err
+	}
 
-		// Iterate over the matching search expressions
-		for i, name := range matchingSearches {
-			if i > 0 {
-				lastElement := conditionResult[len(conditionResult)-1]
-				// If the last element in the condition result is not " ", " OR ", or "(", add " OR " to the condition result
-				if lastElement != " " && lastElement != " OR " && lastElement != "(" {
-					conditionResult = append(conditionResult, " ")
-				}
+	eventMatchers := make([]expression, 0, len(search.EventMatchers))
+	for _, eventMatcher := range search.EventMatchers {
+		fieldMatchers := make([]expression, 0, len(eventMatcher))
+		for _, fieldMatcher := range eventMatcher {
+			filter, err := rule.evaluateFieldMatcher(fieldMatcher, negated)
+			if err != nil {
+				return expression{}, err
+			}
+			if filter.query != "" {
+				fieldMatchers = append(fieldMatchers, filter)
 			}
-			// Evaluate the search expression and append its result to the condition result
-			conditionResult = rule.evaluateSearchExpression(sigma.SearchIdentifier{Name: name}, conditionResult, false)
 		}
 
-		// If there are more than one matching search expressions, add a closing parenthesis to the condition result
-		if !isTopLevel && numMatchingSearches > 1 {
-			conditionResult = append(conditionResult, ")")
+		// An event matcher without field matchers would match any event, which can't be rendered
+		if len(fieldMatchers) == 0 && len(eventMatcher) > 0 {
+			return expression{}, fmt.Errorf("all field matchers of the search were skipped because of unresolved placeholders")
 		}
 
-		return conditionResult
+		filter, err := rule.combine(rule.and(negated), fieldMatchers)
+		if err != nil {
+			return expression{}, err
+		}
+		eventMatchers = append(eventMatchers, filter)
+	}
+
+	if len(eventMatchers) == 0 {
+		return expression{}, nil
 	}
-	panic(fmt.Sprintf("unhandled node type %T", search))
+	return rule.combine(rule.or(negated), eventMatchers)
 }
 
-func (rule RuleEvaluator) evaluateSearch(search sigma.Search) ([]string, error) {
-	var filters []string
+// evaluateFieldMatcher renders a single field matcher, applying its modifiers and the field mappings of the config.
+func (rule RuleEvaluator) evaluateFieldMatcher(fieldMatcher sigma.FieldMatcher, negated bool) (expression, error) {
+	allValuesMustMatch := len(fieldMatcher.Modifiers) > 0 && fieldMatcher.Modifiers[len(fieldMatcher.Modifiers)-1] == "all"
+	fieldModifiers := fieldMatcher.Modifiers
+	if allValuesMustMatch {
+		fieldModifiers = fieldModifiers[:len(fieldModifiers)-1]
+	}
 
-	for i, keyword := range search.Keywords {
-		search.Keywords[i] = fmt.Sprintf("\"%s\"", keyword)
+	valueModifiers, comparator, err := modifiers.GetModifiers(fieldModifiers...)
+	if err != nil {
+		return expression{}, err
 	}
 
-	if len(search.Keywords) > 0 {
-		joined := strings.Join(search.Keywords, " OR ")
-		filter := fmt.Sprintf("(%s)", joined)
-		filters = append(filters, filter)
-		return filters, nil
+	// Placeholders that the configs map to lookup tables are matched against the tables
+	if remaining, lookups := rule.splitLookups(fieldMatcher); len(lookups) > 0 {
+		return rule.evaluateLookups(remaining, lookups, negated)
 	}
 
-	if len(search.EventMatchers) == 0 {
-		return filters, nil
+	matcherValues, err := rule.getMatcherValues(fieldMatcher, comparator)
+	if err != nil {
+		return expression{}, err
+	}
+	if len(matcherValues) == 0 {
+		// All values were unresolved placeholders that are skipped, so the field matcher is left out
+		return expression{}, nil
 	}
 
-	for _, eventMatcher := range search.EventMatchers {
-		for _, fieldMatcher := range eventMatcher {
-			allValuesMustMatch := len(fieldMatcher.Modifiers) > 0 && fieldMatcher.Modifiers[len(fieldMatcher.Modifiers)-1] == "all"
-			fieldModifiers := fieldMatcher.Modifiers
-			if allValuesMustMatch {
-				fieldModifiers = fieldModifiers[:len(fieldModifiers)-1]
+	// Apply the value modifiers to the expected values. A value may be expanded into several values, any of which can match.
+	modifiedValues := make([][]string, len(matcherValues))
+	expanded := false
+	for i, value := range matcherValues {
+		values, err := modifiers.ApplyValueModifiers(valueModifiers, value)
+		if errors.Is(err, modifiers.ErrWindashLimit) {
+			return rule.evaluateWindashPatterns(fieldMatcher, valueModifiers, comparator, matcherValues, allValuesMustMatch, negated, err)
+		} else if err != nil {
+			return expression{}, err
+		}
+		for _, value := range values {
+			// Raw bytes would be rendered into the query as unprintable text
+			if err := modifiers.RequireEncoded(value); err != nil {
+				line, column := fieldMatcher.Position()
+				return expression{}, fmt.Errorf("field %s (line %d, column %d): %w", fieldMatcher.Field, line+1, column+1, err)
 			}
+			modifiedValues[i] = append(modifiedValues[i], fmt.Sprint(value))
+		}
+		expanded = expanded || len(values) > 1
+	}
 
-			comparator, err := modifiers.GetComparator(fieldModifiers...)
-			if rule.caseSensitive {
-				comparator, err = modifiers.GetComparatorCaseSensitive(fieldModifiers...)
-			}
-			if err != nil {
-				return filters, err
+	// The exists modifier only takes booleans, which are validated here so that the error has the position in the rule
+	if comparator == "exists" {
+		for _, values := range modifiedValues {
+			for _, value := range values {
+				if _, err := modifiers.ParseExists(value); err != nil {
+					line, column := fieldMatcher.Position()
+					return expression{}, fmt.Errorf("field %s (line %d, column %d): %w", fieldMatcher.Field, line+1, column+1, err)
+				}
 			}
+		}
+	}
 
-			matcherValues, err := rule.getMatcherValues(fieldMatcher)
-			if err != nil {
-				return filters, err
+	// Networks are validated here rather than by the backends, so that invalid ones are reported with their position in the rule
+	if comparator == "cidr" {
+		for _, values := range modifiedValues {
+			for _, value := range values {
+				if _, err := netip.ParsePrefix(value); err != nil {
+					line, column := fieldMatcher.Position()
+					return expression{}, fmt.Errorf("invalid cidr %s for field %s (line %d, column %d)", value, fieldMatcher.Field, line+1, column+1)
+				}
 			}
+		}
+	}
 
-			targetFields := []string{fieldMatcher.Field}
-			if len(rule.fieldmappings[fieldMatcher.Field]) > 0 {
-				targetFields = rule.fieldmappings[fieldMatcher.Field]
-			}
+	targetFields := rule.targetFields(fieldMatcher.Field)
 
-			filter, err := rule.matcherMatchesValues(matcherValues, targetFields, comparator, allValuesMustMatch)
+	// If all values must match, each value must match any of the values it was expanded into
+	if allValuesMustMatch && expanded {
+		filters := make([]expression, len(modifiedValues))
+		for i, values := range modifiedValues {
+			filters[i], err = rule.matcherMatchesValues(values, targetFields, comparator, false, negated)
 			if err != nil {
-				return filters, err
+				return expression{}, err
 			}
+		}
+		return rule.combine(rule.and(negated), filters)
+	}
+
+	var values []string
+	for _, modified := range modifiedValues {
+		values = append(values, modified...)
+	}
+	return rule.matcherMatchesValues(values, targetFields, comparator, allValuesMustMatch, negated)
+}
 
-			filters = append(filters, filter)
+// evaluateWindashPatterns matches the values of a field matcher that windash can't expand, because they have too many flags,
+// with regular expressions that have a character class of the flag characters at the position of each flag.
+// The limit error of windash is returned if the values can't be matched with regular expressions.
+func (rule RuleEvaluator) evaluateWindashPatterns(fieldMatcher sigma.FieldMatcher, valueModifiers []modifiers.ValueModifier, comparator string, values []string, allValuesMustMatch bool, negated bool, limitErr error) (expression, error) {
+	line, column := fieldMatcher.Position()
+	patterns := make([]string, len(values))
+	for i, value := range values {
+		pattern, ok := modifiers.WindashPattern(valueModifiers, comparator, value, rule.caseSensitive)
+		if !ok {
+			return expression{}, fmt.Errorf("field %s (line %d, column %d): %w", fieldMatcher.Field, line+1, column+1, limitErr)
 		}
+		patterns[i] = pattern
 	}
 
-	return filters, nil
+	result, err := rule.matcherMatchesValues(patterns, rule.targetFields(fieldMatcher.Field), "re", allValuesMustMatch, negated)
+	if err != nil && !errors.Is(err, backends.ErrFilterRequired) {
+		return expression{}, fmt.Errorf("field %s (line %d, column %d): %w, and the backend can't match it with a regular expression: %v", fieldMatcher.Field, line+1, column+1, limitErr, err)
+	}
+	return result, err
 }
 
 // getMatcherValues function retrieves the matching values for a field matcher.
-func (rule *RuleEvaluator) getMatcherValues(matcher sigma.FieldMatcher) ([]string, error) {
+// Placeholders are only expanded if the field matcher has the expand modifier.
+func (rule *RuleEvaluator) getMatcherValues(matcher sigma.FieldMatcher, comparator string) ([]string, error) {
+	expand := slices.Contains(matcher.Modifiers, "expand")
+
 	// Initialize an empty array for the matching values.
 	matcherValues := []string{}
 
@@ -271,11 +399,8 @@ func (rule *RuleEvaluator) getMatcherValues(matcher sigma.FieldMatcher) ([]strin
 		}
 
 		// If the value is a placeholder, expand it to its corresponding values using the provided expandPlaceholder function.
-		if strings.HasPrefix(value, "%") && strings.HasSuffix(value, "%") {
-			if rule.expandPlaceholder == nil {
-				return nil, fmt.Errorf("can't expand %s, no placeholder expander function defined", value)
-			}
-			placeholderValues, err := rule.expandPlaceholder(value)
+		if expand && strings.HasPrefix(value, "%") && strings.HasSuffix(value, "%") {
+			placeholderValues, err := rule.resolvePlaceholder(value, comparator)
 			if err != nil {
 				return nil, fmt.Errorf("failed to expand placeholder: %w", err)
 			}
@@ -291,46 +416,47 @@ func (rule *RuleEvaluator) getMatcherValues(matcher sigma.FieldMatcher) ([]strin
 }
 
 // matcherMatchesValues takes a list of values to match against a list of fields,
-// a comparator function to compare values and fields, and a boolean indicating whether all values must match or any of them.
-// It returns a string representing a filter that can be used to match events with the specified fields and values.
-func (rule *RuleEvaluator) matcherMatchesValues(matcherValues []string, fields []string, comparator modifiers.ComparatorFunc, allValuesMustMatch bool) (string, error) {
-	var filters []string
-	for i, field := range fields {
-		var subFilters []string
-		for j, value := range matcherValues {
-			// compare field and value using the provided comparator function
-			filter, err := comparator(field, value)
-			if err != nil {
-				return "", err
+// the comparator to compare values and fields, and a boolean indicating whether all values must match or any of them.
+// It returns an expression representing a filter that can be used to match events with the specified fields and values.
+// If negated is set, the negated comparisons are rendered instead.
+func (rule RuleEvaluator) matcherMatchesValues(matcherValues []string, fields []string, comparator string, allValuesMustMatch bool, negated bool) (expression, error) {
+	// if all values must match, values are ANDed, otherwise any value can match
+	join := rule.or(negated)
+	if allValuesMustMatch {
+		join = rule.and(negated)
+	}
+
+	filters := make([]expression, 0, len(fields))
+	for _, field := range fields {
+		subFilters := make([]expression, 0, len(matcherValues))
+		for _, value := range matcherValues {
+			// compare field and value using the backend
+			match := backends.FieldMatch{
+				Field:         field,
+				Comparator:    comparator,
+				Value:         value,
+				CaseSensitive: rule.caseSensitive,
 			}
-			if j == 0 {
-				// first match value should be added directly to subFilters
-				subFilters = append(subFilters, filter)
-			} else if allValuesMustMatch {
-				// if all values must match, add " " between subfilters
-				subFilters = append(subFilters, " ", filter)
+			var filter string
+			var err error
+			if negated {
+				filter, err = rule.backend.(backends.NegationPusher).NotFieldMatch(match)
 			} else {
-				// if any value can match, add " OR " between subfilters
-				subFilters = append(subFilters, " OR ", filter)
+				filter, err = rule.backend.FieldMatch(match)
 			}
+			if err != nil {
+				return expression{}, err
+			}
+			subFilters = append(subFilters, expression{query: filter})
 		}
-		if len(matcherValues) > 1 {
-			// if there are multiple matcher values, wrap subFilters in parentheses to keep operator precedence
-			filters = append(filters, "("+strings.Join(subFilters, "")+")")
-		} else {
-			// if there's only one matcher value, subFilters can be added directly to filters
-			filters = append(filters, subFilters...)
-		}
-		if i < len(fields)-1 {
-			// if there are multiple fields, add " OR " between them
-			filters = append(filters, " OR ")
+
+		filter, err := rule.combine(join, subFilters)
+		if err != nil {
+			return expression{}, err
 		}
+		filters = append(filters, filter)
 	}
-	if len(fields) > 1 {
-		// if there are multiple fields, wrap filters in parentheses to keep operator precedence
-		return "(" + strings.Join(filters, "") + ")", nil
-	} else {
-		// if there's only one field, filters can be added directly
-		return strings.Join(filters, ""), nil
-	}
+
+	// if there are multiple fields, any of them can match
+	return rule.combine(rule.or(negated), filters)
 }
@@ -22,3 +22,19 @@ func (rule *RuleEvaluator) calculateFieldMappings() {
 	// Set the field mappings of the RuleEvaluator to the compiled mappings.
 	rule.fieldmappings = mappings
 }
+
+// targetFields returns the event fieldnames that the given rule fieldname is mapped to, or the fieldname itself if there is no mapping.
+func (rule RuleEvaluator) targetFields(field string) []string {
+	if len(rule.fieldmappings[field]) > 0 {
+		return rule.fieldmappings[field]
+	}
+	return []string{field}
+}
+
+// mapField returns the first event fieldname that the given rule fieldname is mapped to, or the fieldname itself if there is no mapping.
+func (rule RuleEvaluator) mapField(field string) string {
+	if len(rule.fieldmappings[field]) != 0 {
+		return rule.fieldmappings[field][0]
+	}
+	return field
+}
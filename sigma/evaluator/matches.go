@@ -0,0 +1,248 @@
+package evaluator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mtnmunuklu/bridge/sigma"
+	"github.com/mtnmunuklu/bridge/sigma/evaluator/modifiers"
+)
+
+// Matches evaluates the rule's detection directly against a decoded JSON event and reports whether the event matches.
+// The event must also match the conditions of the config's logsource mappings. The field names of the rule are
+// mapped to the event's keys using the config's field mappings, and nested objects can be accessed with dotted field names.
+// Aggregations can't be evaluated against a single event, so rules with aggregations return an error.
+func (rule RuleEvaluator) Matches(event map[string]any) (bool, error) {
+	// The conditions of the logsource mappings must all match
+	for _, indexCondition := range rule.indexConditions {
+		if len(indexCondition.Keywords) == 0 && len(indexCondition.EventMatchers) == 0 {
+			continue
+		}
+		matches, err := rule.matchSearch(indexCondition, event)
+		if err != nil {
+			return false, fmt.Errorf("error evaluating logsource conditions: %w", err)
+		}
+		if !matches {
+			return false, nil
+		}
+	}
+
+	// The event matches the rule if any of the conditions matches
+	for _, condition := range rule.Detection.Conditions {
+		if condition.Aggregation != nil {
+			return false, fmt.Errorf("aggregations can't be evaluated against a single event")
+		}
+		matches, err := rule.matchSearchExpression(condition.Search, event)
+		if err != nil {
+			return false, err
+		}
+		if matches {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchSearchExpression evaluates a Sigma search expression recursively against the event.
+func (rule RuleEvaluator) matchSearchExpression(search sigma.SearchExpr, event map[string]any) (bool, error) {
+	switch s := search.(type) {
+	case sigma.And:
+		for _, node := range s {
+			matches, err := rule.matchSearchExpression(node, event)
+			if err != nil || !matches {
+				return false, err
+			}
+		}
+		return true, nil
+
+	case sigma.Or:
+		for _, node := range s {
+			matches, err := rule.matchSearchExpression(node, event)
+			if err != nil || matches {
+				return matches, err
+			}
+		}
+		return false, nil
+
+	case sigma.Not:
+		matches, err := rule.matchSearchExpression(s.Expr, event)
+		return !matches, err
+
+	case sigma.SearchIdentifier:
+		search, ok := rule.Detection.Searches[s.Name]
+		if !ok {
+			return false, fmt.Errorf("undefined search identifier %s", s.Name)
+		}
+		matches, err := rule.matchSearch(search, event)
+		if err != nil {
+			return false, fmt.Errorf("error evaluating search %s: %w", s.Name, err)
+		}
+		return matches, nil
+
+	case sigma.OneOfThem:
+		return rule.matchSearchExpression(sigma.Or(rule.matchingSearches("*")), event)
+
+	case sigma.OneOfPattern:
+		return rule.matchSearchExpression(sigma.Or(rule.matchingSearches(s.Pattern)), event)
+
+	case sigma.OneOfIdentifier:
+		return rule.matchSearchExpression(s.Ident, event)
+
+	case sigma.AllOfThem:
+		return rule.matchSearchExpression(sigma.And(rule.matchingSearches("*")), event)
+
+	case sigma.AllOfPattern:
+		return rule.matchSearchExpression(sigma.And(rule.matchingSearches(s.Pattern)), event)
+
+	case sigma.AllOfIdentifier:
+		return rule.matchSearchExpression(s.Ident, event)
+	}
+	return false, fmt.Errorf("unhandled node type %T", search)
+}
+
+// matchSearch evaluates a single search against the event.
+// A keyword matches if any value of the event contains it, the field matchers of an event matcher must all match
+// and any of the event matchers must match.
+func (rule RuleEvaluator) matchSearch(search sigma.Search, event map[string]any) (bool, error) {
+	if len(search.Keywords) > 0 {
+		matcher, err := rule.getMatcher("contains")
+		if err != nil {
+			return false, err
+		}
+
+		values := eventLeaves(event, nil)
+		for _, keyword := range search.Keywords {
+			for _, value := range values {
+				matches, err := matcher(value, keyword)
+				if err != nil || matches {
+					return matches, err
+				}
+			}
+		}
+		return false, nil
+	}
+
+	for _, eventMatcher := range search.EventMatchers {
+		matches := true
+		for _, fieldMatcher := range eventMatcher {
+			var err error
+			matches, err = rule.matchFieldMatcher(fieldMatcher, event)
+			if err != nil {
+				return false, err
+			}
+			if !matches {
+				break
+			}
+		}
+		if matches {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchFieldMatcher evaluates a single field matcher against the event, applying its modifiers and the field mappings of the config.
+// Any of the expected values must match any of the event's values for the field, unless the all modifier is used.
+func (rule RuleEvaluator) matchFieldMatcher(fieldMatcher sigma.FieldMatcher, event map[string]any) (bool, error) {
+	allValuesMustMatch := len(fieldMatcher.Modifiers) > 0 && fieldMatcher.Modifiers[len(fieldMatcher.Modifiers)-1] == "all"
+	fieldModifiers := fieldMatcher.Modifiers
+	if allValuesMustMatch {
+		fieldModifiers = fieldModifiers[:len(fieldModifiers)-1]
+	}
+
+	matcher, err := rule.getMatcher(fieldModifiers...)
+	if err != nil {
+		return false, err
+	}
+
+	_, comparator, _ := modifiers.GetModifiers(fieldModifiers...)
+	matcherValues, err := rule.getMatcherValues(fieldMatcher, comparator)
+	if err != nil {
+		return false, err
+	}
+	if len(matcherValues) == 0 {
+		// All values were unresolved placeholders that are skipped, so the field matcher is left out
+		return true, nil
+	}
+
+	targetFields := rule.targetFields(fieldMatcher.Field)
+
+	// Collect the event's values of all the fields the rule's field is mapped to
+	var actualValues []any
+	for _, field := range targetFields {
+		actualValues = append(actualValues, eventValues(event, field)...)
+	}
+	if len(actualValues) == 0 {
+		// Missing fields are matched as null values
+		actualValues = []any{nil}
+	}
+
+	for _, expected := range matcherValues {
+		matches := false
+		for _, actual := range actualValues {
+			matches, err = matcher(actual, expected)
+			if err != nil {
+				return false, err
+			}
+			if matches {
+				break
+			}
+		}
+
+		switch {
+		case matches && !allValuesMustMatch:
+			return true, nil
+		case !matches && allValuesMustMatch:
+			return false, nil
+		}
+	}
+	return allValuesMustMatch, nil
+}
+
+// getMatcher returns the matcher function for the modifiers, respecting the case sensitivity of the evaluator.
+func (rule RuleEvaluator) getMatcher(fieldModifiers ...string) (modifiers.MatcherFunc, error) {
+	if rule.caseSensitive {
+		return modifiers.GetMatcherCaseSensitive(fieldModifiers...)
+	}
+	return modifiers.GetMatcher(fieldModifiers...)
+}
+
+// eventValues returns the values of the field in the event.
+// If the event has no such key, dotted field names are looked up in nested objects. Arrays are flattened.
+func eventValues(event map[string]any, field string) []any {
+	value, ok := event[field]
+	if !ok {
+		parent, child, nested := strings.Cut(field, ".")
+		if !nested {
+			return nil
+		}
+		object, ok := event[parent].(map[string]any)
+		if !ok {
+			return nil
+		}
+		return eventValues(object, child)
+	}
+
+	if values, ok := value.([]any); ok {
+		return values
+	}
+	return []any{value}
+}
+
+// eventLeaves appends all the scalar values of the event, including those of nested objects and arrays, to values.
+func eventLeaves(value any, values []any) []any {
+	switch v := value.(type) {
+	case map[string]any:
+		for _, child := range v {
+			values = eventLeaves(child, values)
+		}
+	case []any:
+		for _, child := range v {
+			values = eventLeaves(child, values)
+		}
+	case nil:
+	default:
+		values = append(values, v)
+	}
+	return values
+}
@@ -0,0 +1,255 @@
+package modifiers
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MatcherFunc reports whether an actual event value matches the expected value of a field matcher.
+type MatcherFunc func(actual, expected any) (bool, error)
+
+// GetMatcher returns a function that matches event values against expected values using the given modifiers.
+// String comparisons are case-insensitive, as defined by the Sigma spec.
+func GetMatcher(modifiers ...string) (MatcherFunc, error) {
+	return getMatcher(Comparators, false, modifiers...)
+}
+
+// GetMatcherCaseSensitive returns a function that matches event values against expected values using the given modifiers.
+// String comparisons are case sensitive.
+func GetMatcherCaseSensitive(modifiers ...string) (MatcherFunc, error) {
+	return getMatcher(ComparatorsCaseSensitive, true, modifiers...)
+}
+
+func getMatcher(comparators map[string]Comparator, caseSensitive bool, modifiers ...string) (MatcherFunc, error) {
+	valueModifiers, comparatorName, err := GetModifiers(modifiers...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Base64 encoded text is case sensitive, so encoded values are always compared case-sensitively
+	if !caseSensitive && encodesBase64(valueModifiers) {
+		return getMatcher(ComparatorsCaseSensitive, true, modifiers...)
+	}
+
+	// If no comparator is specified, the default comparator is used
+	comparator := comparators[comparatorName]
+	if comparator == nil {
+		if caseSensitive {
+			comparator = baseComparatorCaseSensitive{}
+		} else {
+			comparator = baseComparator{}
+		}
+	}
+
+	return func(actual, expected any) (bool, error) {
+		values, err := ApplyValueModifiers(valueModifiers, expected)
+		if errors.Is(err, ErrWindashLimit) {
+			// The value is matched with a character class of the flag characters rather than every variant of them
+			if pattern, ok := WindashPattern(valueModifiers, comparatorName, coerceString(expected), caseSensitive); ok {
+				return re{}.Matches(actual, pattern)
+			}
+		}
+		if err != nil {
+			return false, err
+		}
+
+		// A value that the modifiers expanded into several values matches if any of them matches
+		for _, value := range values {
+			if err := RequireEncoded(value); err != nil {
+				return false, err
+			}
+			matches, err := comparator.Matches(actual, value)
+			if err != nil || matches {
+				return matches, err
+			}
+		}
+		return false, nil
+	}, nil
+}
+
+// encodesBase64 reports whether any of the value modifiers encodes the value as base64.
+func encodesBase64(valueModifiers []ValueModifier) bool {
+	for _, modifier := range valueModifiers {
+		switch modifier.(type) {
+		case b64, b64offset:
+			return true
+		}
+	}
+	return false
+}
+
+func (baseComparator) Matches(actual, expected any) (bool, error) {
+	if expected == "null" {
+		return actual == nil, nil
+	}
+	return matchString(actual, expected, false, false, false)
+}
+
+func (contains) Matches(actual, expected any) (bool, error) {
+	return matchString(actual, expected, true, true, false)
+}
+
+func (endswith) Matches(actual, expected any) (bool, error) {
+	return matchString(actual, expected, true, false, false)
+}
+
+func (startswith) Matches(actual, expected any) (bool, error) {
+	return matchString(actual, expected, false, true, false)
+}
+
+func (baseComparatorCaseSensitive) Matches(actual, expected any) (bool, error) {
+	if expected == "null" {
+		return actual == nil, nil
+	}
+	return matchString(actual, expected, false, false, true)
+}
+
+func (containsCS) Matches(actual, expected any) (bool, error) {
+	return matchString(actual, expected, true, true, true)
+}
+
+func (endswithCS) Matches(actual, expected any) (bool, error) {
+	return matchString(actual, expected, true, false, true)
+}
+
+func (startswithCS) Matches(actual, expected any) (bool, error) {
+	return matchString(actual, expected, false, true, true)
+}
+
+func (re) Matches(actual any, expected any) (bool, error) {
+	if actual == nil {
+		return false, nil
+	}
+	pattern, err := compile(coerceString(expected))
+	if err != nil {
+		return false, err
+	}
+	return pattern.MatchString(coerceString(actual)), nil
+}
+
+func (exists) Matches(actual any, expected any) (bool, error) {
+	present, err := ParseExists(expected)
+	if err != nil {
+		return false, err
+	}
+	return (actual != nil) == present, nil
+}
+
+func (cidr) Matches(actual any, expected any) (bool, error) {
+	prefix, err := netip.ParsePrefix(coerceString(expected))
+	if err != nil {
+		return false, fmt.Errorf("invalid cidr %v: %w", expected, err)
+	}
+	if actual == nil {
+		return false, nil
+	}
+	addr, err := netip.ParseAddr(coerceString(actual))
+	if err != nil {
+		// Values that aren't IP addresses never match
+		return false, nil
+	}
+	return prefix.Contains(addr.Unmap()), nil
+}
+
+func (gt) Matches(actual any, expected any) (bool, error) {
+	return compareNumbers(actual, expected, func(a, e float64) bool { return a > e })
+}
+
+func (gte) Matches(actual any, expected any) (bool, error) {
+	return compareNumbers(actual, expected, func(a, e float64) bool { return a >= e })
+}
+
+func (lt) Matches(actual any, expected any) (bool, error) {
+	return compareNumbers(actual, expected, func(a, e float64) bool { return a < e })
+}
+
+func (lte) Matches(actual any, expected any) (bool, error) {
+	return compareNumbers(actual, expected, func(a, e float64) bool { return a <= e })
+}
+
+// compareNumbers compares the actual and expected values as numbers. Actual values that aren't numbers never match.
+func compareNumbers(actual, expected any, compare func(actual, expected float64) bool) (bool, error) {
+	e, err := strconv.ParseFloat(coerceString(expected), 64)
+	if err != nil {
+		return false, fmt.Errorf("expected a number, got %v", expected)
+	}
+	if actual == nil {
+		return false, nil
+	}
+	a, err := strconv.ParseFloat(coerceString(actual), 64)
+	if err != nil {
+		return false, nil
+	}
+	return compare(a, e), nil
+}
+
+// matchString matches the actual value against the expected wildcard pattern. Missing values never match.
+func matchString(actual, expected any, leading, trailing, caseSensitive bool) (bool, error) {
+	if actual == nil {
+		return false, nil
+	}
+	return matchWildcards(coerceString(actual), coerceString(expected), leading, trailing, caseSensitive)
+}
+
+// matchWildcards reports whether the actual value matches the Sigma wildcard pattern.
+// The * and ? wildcards can be escaped with a backslash, as can a backslash itself.
+// If leading or trailing is set, the pattern may also be preceded or followed by any characters.
+func matchWildcards(actual, pattern string, leading, trailing, caseSensitive bool) (bool, error) {
+	var builder strings.Builder
+	if !caseSensitive {
+		builder.WriteString("(?is)")
+	} else {
+		builder.WriteString("(?s)")
+	}
+	builder.WriteString("^")
+	if leading {
+		builder.WriteString(".*")
+	}
+
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '\\' && i+1 < len(runes) && (runes[i+1] == '*' || runes[i+1] == '?' || runes[i+1] == '\\'):
+			builder.WriteString(regexp.QuoteMeta(string(runes[i+1])))
+			i++
+		case r == '*':
+			builder.WriteString(".*")
+		case r == '?':
+			builder.WriteString(".")
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	if trailing {
+		builder.WriteString(".*")
+	}
+	builder.WriteString("$")
+
+	compiled, err := compile(builder.String())
+	if err != nil {
+		return false, err
+	}
+	return compiled.MatchString(actual), nil
+}
+
+// compiledPatterns caches the compiled regular expressions, as the same patterns are matched against many events.
+var compiledPatterns sync.Map
+
+// compile compiles the regular expression, or returns it from the cache.
+func compile(pattern string) (*regexp.Regexp, error) {
+	if compiled, ok := compiledPatterns.Load(pattern); ok {
+		return compiled.(*regexp.Regexp), nil
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	compiledPatterns.Store(pattern, compiled)
+	return compiled, nil
+}
@@ -1,10 +1,16 @@
 package modifiers
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"math"
+	"net/netip"
+	"regexp"
 	"strings"
+	"unicode"
 	"unicode/utf16"
 )
 
@@ -17,95 +23,166 @@ func GetComparatorCaseSensitive(modifiers ...string) (ComparatorFunc, error) {
 }
 
 func getComparator(comparators map[string]Comparator, caseSensitive bool, modifiers ...string) (ComparatorFunc, error) {
-	if len(modifiers) == 0 {
+	valueModifiers, comparatorName, err := GetModifiers(modifiers...)
+	if err != nil {
+		return nil, err
+	}
+
+	// If no comparator is specified, the default comparator is used
+	comparator := comparators[comparatorName]
+	if comparator == nil {
 		if caseSensitive {
-			return baseComparatorCaseSensitive{}.Bridges, nil
+			comparator = baseComparatorCaseSensitive{}
+		} else {
+			comparator = baseComparator{}
 		}
-		return baseComparator{}.Bridges, nil
 	}
 
+	return func(field, value any) (string, error) {
+		values, err := ApplyValueModifiers(valueModifiers, value)
+		if errors.Is(err, ErrWindashLimit) {
+			// Values with too many flags to expand are rendered as a regular expression instead
+			if pattern, ok := WindashPattern(valueModifiers, comparatorName, coerceString(value), caseSensitive); ok {
+				return re{}.Bridges(field, pattern)
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+
+		// A value that the modifiers expanded into several values matches any of them
+		results := make([]string, len(values))
+		for i, value := range values {
+			if err := RequireEncoded(value); err != nil {
+				return "", err
+			}
+			results[i], err = comparator.Bridges(field, value)
+			if err != nil {
+				return "", err
+			}
+		}
+		if len(results) == 1 {
+			return results[0], nil
+		}
+		return "(" + strings.Join(results, " OR ") + ")", nil
+	}, nil
+}
+
+// ApplyValueModifiers applies the value modifiers to the value in order, and returns the values it results in.
+// Most modifiers turn a value into a single value, but some expand it into several, such as the windash modifier.
+func ApplyValueModifiers(valueModifiers []ValueModifier, value any) ([]any, error) {
+	values := []any{value}
+	for _, modifier := range valueModifiers {
+		var modified []any
+		for _, value := range values {
+			result, err := modifier.Modify(value)
+			if err != nil {
+				return nil, err
+			}
+			modified = append(modified, result...)
+		}
+		values = modified
+	}
+	return values, nil
+}
+
+// GetModifiers validates a sequence of modifiers and splits it into the value modifiers that have to be applied to the expected value
+// and the name of the comparator modifier. The comparator name is empty if the default comparator should be used.
+func GetModifiers(modifiers ...string) ([]ValueModifier, string, error) {
 	// A valid sequence of modifiers is ([ValueModifier]*)[Comparator]?
-	// If a comparator is specified, it must be in the last position and cannot be succeeded by any other modifiers
-	// If no comparator is specified, the default comparator is used
+	// If a comparator is specified, it must be in the last position and cannot be succeeded by any other modifiers,
+	// except for the flags of the re comparator
 	var valueModifiers []ValueModifier
-	var comparator Comparator
-	for i, modifier := range modifiers {
-		comparatorModifier := comparators[modifier]
+	var comparator, flags string
+	for _, modifier := range modifiers {
+		comparatorModifier := Comparators[modifier]
 		valueModifier := ValueModifiers[modifier]
+		_, regexFlag := RegexFlags[modifier]
 		switch {
 		// Validate correctness
+		case regexFlag && comparator != "re":
+			return nil, "", fmt.Errorf("modifier %s must follow the re modifier", modifier)
+		case regexFlag:
+			if !strings.Contains(flags, RegexFlags[modifier]) {
+				flags += RegexFlags[modifier]
+			}
 		case comparatorModifier == nil && valueModifier == nil:
-			return nil, fmt.Errorf("unknown modifier %s", modifier)
-		case i < len(modifiers)-1 && comparators[modifier] != nil:
-			return nil, fmt.Errorf("comparator modifier %s must be the last modifier", modifier)
+			return nil, "", fmt.Errorf("unknown modifier %s", modifier)
+		case comparator != "":
+			return nil, "", fmt.Errorf("comparator modifier %s must be the last modifier", comparator)
 
 		// Build up list of modifiers
 		case valueModifier != nil:
 			valueModifiers = append(valueModifiers, valueModifier)
 		case comparatorModifier != nil:
-			comparator = comparatorModifier
-		}
-	}
-	if comparator == nil {
-		if caseSensitive {
-			comparator = baseComparatorCaseSensitive{}
-		} else {
-			comparator = baseComparator{}
+			comparator = modifier
 		}
 	}
 
-	return func(field, value any) (string, error) {
-		var err error
-		for _, modifier := range valueModifiers {
-			value, err = modifier.Modify(value)
-			if err != nil {
-				return "", err
-			}
-		}
+	// The flags of the re comparator are set inline at the start of the regular expression
+	if flags != "" {
+		valueModifiers = append(valueModifiers, regexFlags(flags))
+	}
 
-		return comparator.Bridges(field, value)
-	}, nil
+	return valueModifiers, comparator, nil
 }
 
 type Comparator interface {
 	Bridges(field any, value any) (string, error)
+	Matches(actual any, expected any) (bool, error)
 }
 
 type ComparatorFunc func(field, value any) (string, error)
 
 // ValueModifier modifies the expected value before it is passed to the comparator.
 // For example, the `base64` modifier converts the expected value to base64.
+// A modifier may expand the value into several values, any of which the comparator matches, such as the `windash` modifier.
 type ValueModifier interface {
-	Modify(value any) (any, error)
+	Modify(value any) ([]any, error)
 }
 
 var Comparators = map[string]Comparator{
 	"contains":   contains{},
 	"endswith":   endswith{},
 	"startswith": startswith{},
-	//"re":         re{},
-	"cidr": cidr{},
-	"gt":   gt{},
-	"gte":  gte{},
-	"lt":   lt{},
-	"lte":  lte{},
+	"re":         re{},
+	"cidr":       cidr{},
+	"exists":     exists{},
+	"gt":         gt{},
+	"gte":        gte{},
+	"lt":         lt{},
+	"lte":        lte{},
 }
 
 var ComparatorsCaseSensitive = map[string]Comparator{
 	"contains":   containsCS{},
 	"endswith":   endswithCS{},
 	"startswith": startswithCS{},
-	//"re":         re{},
-	"cidr": cidr{},
-	"gt":   gt{},
-	"gte":  gte{},
-	"lt":   lt{},
-	"lte":  lte{},
+	"re":         re{},
+	"cidr":       cidr{},
+	"exists":     exists{},
+	"gt":         gt{},
+	"gte":        gte{},
+	"lt":         lt{},
+	"lte":        lte{},
 }
 
 var ValueModifiers = map[string]ValueModifier{
-	"base64": b64{},
-	"wide":   wide{},
+	"base64":       b64{},
+	"base64offset": b64offset{},
+	"wide":         utf16Encoding{order: binary.LittleEndian},
+	"utf16le":      utf16Encoding{order: binary.LittleEndian},
+	"utf16be":      utf16Encoding{order: binary.BigEndian},
+	"utf16":        utf16Encoding{order: binary.LittleEndian, bom: true},
+	"windash":      windash{},
+	"expand":       expand{},
+}
+
+// RegexFlags maps the modifiers that can follow the re comparator to the inline flags of the regular expression.
+var RegexFlags = map[string]string{
+	"i": "i", // Case-insensitive matching
+	"m": "m", // ^ and $ match at the start and end of each line
+	"s": "s", // . matches newlines
 }
 
 type baseComparator struct{}
@@ -167,16 +244,60 @@ func (startswithCS) Bridges(field, value any) (string, error) {
 	return fmt.Sprintf("%v=\"%v*\"", strings.ToLower(coerceString(field)), EscapeBackslashes(coerceString(value))), nil
 }
 
+// re renders an eval expression rather than a search term, as SPL can only match regular expressions in a where command.
+// Sigma regular expressions are case-sensitive, unless the i flag is set.
 type re struct{}
 
 func (re) Bridges(field any, value any) (string, error) {
-	return fmt.Sprintf("| regex %v=\"%v\"", strings.ToLower(coerceString(field)), EscapeBackslashes(coerceString(value))), nil
+	pattern := strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(coerceString(value))
+	return fmt.Sprintf("match(%v, \"%v\")", evalField(field), pattern), nil
 }
 
+// cidr renders an eval expression rather than a search term, as SPL can only match IPv6 and non octet-aligned networks
+// with the cidrmatch function of a where command.
 type cidr struct{}
 
 func (cidr) Bridges(field any, value any) (string, error) {
-	return fmt.Sprintf("%v=\"%v\"", strings.ToLower(coerceString(field)), coerceString(value)), nil
+	prefix, err := netip.ParsePrefix(coerceString(value))
+	if err != nil {
+		return "", fmt.Errorf("invalid cidr %v: %w", value, err)
+	}
+	return fmt.Sprintf("cidrmatch(\"%v\", %v)", prefix, evalField(field)), nil
+}
+
+// evalField returns the field name for an eval expression. Field names that aren't plain identifiers have to be quoted.
+func evalField(field any) string {
+	name := strings.ToLower(coerceString(field))
+	if strings.ContainsFunc(name, func(r rune) bool { return !(r == '_' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9') }) {
+		name = "'" + strings.ReplaceAll(name, "'", "\\'") + "'"
+	}
+	return name
+}
+
+// exists renders a presence check of the field, the value must be true or false.
+type exists struct{}
+
+func (exists) Bridges(field any, value any) (string, error) {
+	present, err := ParseExists(value)
+	if err != nil {
+		return "", err
+	}
+	if present {
+		return fmt.Sprintf("%v=*", strings.ToLower(coerceString(field))), nil
+	}
+	// The negation is grouped, so that it stays a single term when the field match is negated or joined
+	return fmt.Sprintf("(NOT %v=*)", strings.ToLower(coerceString(field))), nil
+}
+
+// ParseExists parses the value of the exists modifier, which must be true or false.
+func ParseExists(value any) (bool, error) {
+	switch coerceString(value) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("the exists modifier expects true or false, got %v", value)
 }
 
 type gt struct{}
@@ -205,19 +326,179 @@ func (lte) Bridges(field any, value any) (string, error) {
 
 type b64 struct{}
 
-func (b64) Modify(value any) (any, error) {
-	return base64.StdEncoding.EncodeToString([]byte(coerceString(value))), nil
+func (b64) Modify(value any) ([]any, error) {
+	return []any{base64.StdEncoding.EncodeToString([]byte(coerceString(value)))}, nil
 }
 
-type wide struct{}
+// b64offset encodes the value as base64 at each of the three offsets it can be at in a longer base64 encoded string.
+// The value is shifted by prefixing it with zero to two bytes, and the characters of each encoding that depend on
+// the surrounding bytes are trimmed from its start and end.
+type b64offset struct{}
+
+func (b64offset) Modify(value any) ([]any, error) {
+	data := []byte(coerceString(value))
+	startOffsets := []int{0, 2, 3}
+	endOffsets := []int{0, 3, 2}
+
+	results := make([]any, 0, 3)
+	for i := 0; i < 3; i++ {
+		encoded := base64.StdEncoding.EncodeToString(append(bytes.Repeat([]byte(" "), i), data...))
+		end := len(encoded) - endOffsets[(len(data)+i)%3]
+		if startOffsets[i] >= end {
+			continue
+		}
+		results = append(results, encoded[startOffsets[i]:end])
+	}
+	return results, nil
+}
+
+// regexFlags sets the flags of a regular expression with an inline flag group, e.g. (?i)
+type regexFlags string
+
+func (flags regexFlags) Modify(value any) ([]any, error) {
+	return []any{"(?" + string(flags) + ")" + coerceString(value)}, nil
+}
+
+// utf16Encoding encodes the value as UTF-16 in the given byte order, optionally preceded by a byte order mark.
+// The result is a raw byte slice, which has to be encoded by another modifier (e.g. base64) before it can be searched for.
+type utf16Encoding struct {
+	order binary.ByteOrder
+	bom   bool
+}
 
-func (wide) Modify(value any) (any, error) {
+func (encoding utf16Encoding) Modify(value any) ([]any, error) {
 	runes := utf16.Encode([]rune(coerceString(value)))
-	bytes := make([]byte, 2*len(runes))
+	if encoding.bom {
+		runes = append([]uint16{0xFEFF}, runes...)
+	}
+	encoded := make([]byte, 2*len(runes))
+	for i, r := range runes {
+		encoding.order.PutUint16(encoded[i*2:], r)
+	}
+	return []any{encoded}, nil
+}
+
+// RequireEncoded returns an error if the value is raw bytes of an encoding modifier such as utf16le,
+// which can't be searched for without being encoded as text, e.g. with the base64 modifier.
+func RequireEncoded(value any) error {
+	if _, ok := value.([]byte); ok {
+		return fmt.Errorf("the value is raw bytes of an encoding modifier (wide, utf16le, utf16be or utf16), which must be followed by base64 or base64offset")
+	}
+	return nil
+}
+
+// windashCharacters are the characters that Windows command line flags can start with, as accepted by many Windows programs:
+// hyphen-minus, slash, en dash, em dash and horizontal bar.
+var windashCharacters = []rune{'-', '/', '\u2013', '\u2014', '\u2015'}
+
+// windashLimit is the number of values that windash expands a value into at most, i.e. a value with up to 3 flags.
+// Values with more flags are matched with a regular expression instead, see WindashPattern.
+const windashLimit = 125
+
+// ErrWindashLimit is returned by the windash modifier for values that it would expand into more than windashLimit values.
+var ErrWindashLimit = errors.New("too many flags for the windash modifier")
+
+// expand marks the placeholders among the values, which are expanded by the evaluator before the modifiers are applied.
+type expand struct{}
+
+func (expand) Modify(value any) ([]any, error) {
+	return []any{value}, nil
+}
+
+// windash expands the value into every variant of the dashes and slashes that start its command line flags,
+// i.e. the hyphens and slashes that follow a non-word character (or the start of the value) and precede a word character.
+type windash struct{}
+
+func (windash) Modify(value any) ([]any, error) {
+	runes := []rune(coerceString(value))
+	positions := windashPositions(runes)
+	if variants := math.Pow(float64(len(windashCharacters)), float64(len(positions))); variants > windashLimit {
+		return nil, fmt.Errorf("%w: %s would be expanded into %.0f values, more than the limit of %d", ErrWindashLimit, string(runes), variants, windashLimit)
+	}
+
+	// Build every combination of the flag characters
+	variants := [][]rune{runes}
+	for _, position := range positions {
+		var expanded [][]rune
+		for _, variant := range variants {
+			for _, character := range windashCharacters {
+				next := append([]rune{}, variant...)
+				next[position] = character
+				expanded = append(expanded, next)
+			}
+		}
+		variants = expanded
+	}
+
+	results := make([]any, len(variants))
+	for i, variant := range variants {
+		results[i] = string(variant)
+	}
+	return results, nil
+}
+
+// windashPositions returns the positions of the flag characters of the value, as defined by windash.
+func windashPositions(runes []rune) []int {
+	isWord := func(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+	var positions []int
 	for i, r := range runes {
-		binary.LittleEndian.PutUint16(bytes[i*2:], r)
+		if (r == '-' || r == '/') && (i == 0 || !isWord(runes[i-1])) && i+1 < len(runes) && isWord(runes[i+1]) {
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}
+
+// WindashPattern returns a regular expression that matches the value like the comparator would match every value
+// that windash expands it into, with a character class of the dashes and slashes at the positions of its flags.
+// It reports false if the value modifiers aren't just windash, or the comparator doesn't match strings.
+func WindashPattern(valueModifiers []ValueModifier, comparator string, value string, caseSensitive bool) (string, bool) {
+	if len(valueModifiers) != 1 || valueModifiers[0] != ValueModifiers["windash"] {
+		return "", false
+	}
+	switch comparator {
+	case "", "contains", "startswith", "endswith":
+	default:
+		return "", false
+	}
+
+	runes := []rune(value)
+	flags := make(map[int]bool)
+	for _, position := range windashPositions(runes) {
+		flags[position] = true
+	}
+	class := "[" + regexp.QuoteMeta(string(windashCharacters)) + "]"
+
+	// The wildcards of the value are converted to their regular expressions, unless they are escaped
+	var pattern strings.Builder
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case flags[i]:
+			pattern.WriteString(class)
+		case r == '\\' && i+1 < len(runes) && (runes[i+1] == '*' || runes[i+1] == '?' || runes[i+1] == '\\'):
+			i++
+			pattern.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case r == '*':
+			pattern.WriteString(".*")
+		case r == '?':
+			pattern.WriteString(".")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	result := pattern.String()
+	if comparator == "" || comparator == "startswith" {
+		result = "^" + result
+	}
+	if comparator == "" || comparator == "endswith" {
+		result += "$"
+	}
+	if !caseSensitive {
+		result = "(?i)" + result
 	}
-	return coerceString(bytes), nil
+	return result, true
 }
 
 func coerceString(v interface{}) string {
@@ -0,0 +1,181 @@
+package modifiers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncodingModifiers(t *testing.T) {
+	tests := []struct {
+		name      string
+		modifiers []string
+		value     string
+		expected  string
+	}{
+		{
+			"utf16le|base64offset|contains",
+			[]string{"utf16le", "base64offset", "contains"},
+			"IEX ",
+			`(commandline="*sqbfafgaia*" OR commandline="*karqbyacaa*" OR commandline="*jaeuawaaga*")`,
+		},
+		{
+			"utf16|base64",
+			[]string{"utf16", "base64"},
+			"IEX ",
+			`commandline="//5jaeuawaagaa=="`,
+		},
+		{
+			"wide|base64offset",
+			[]string{"wide", "base64offset"},
+			"IEX ",
+			`(commandline="sqbfafgaia" OR commandline="karqbyacaa" OR commandline="jaeuawaaga")`,
+		},
+		{
+			"utf16be|base64",
+			[]string{"utf16be", "base64"},
+			"IEX ",
+			`commandline="aekarqbyaca="`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comparator, err := GetComparator(tt.modifiers...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			result, err := comparator("CommandLine", tt.value)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestEncodingModifiersMatch(t *testing.T) {
+	// powershell IEX (New-Object), encoded as -EncodedCommand does
+	event := "powershell -enc cABvAHcAZQByAHMAaABlAGwAbAAgAEkARQBYACAAKABOAGUAdwAtAE8AYgBqAGUAYwB0ACkA"
+
+	matcher, err := GetMatcherCaseSensitive("utf16le", "base64offset", "contains")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for value, expected := range map[string]bool{"IEX (": true, "New-Object": true, "Invoke-Expression": false} {
+		matches, err := matcher(event, value)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if matches != expected {
+			t.Errorf("expected %s to match %t, got %t", value, expected, matches)
+		}
+	}
+}
+
+func TestEncodingModifiersMatchCaseSensitive(t *testing.T) {
+	// Base64 encoded values only match with their exact case, even when other values are matched case-insensitively
+	matcher, err := GetMatcher("base64", "contains")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for actual, expected := range map[string]bool{"echo SUVY | base64 -d": true, "echo suvy | base64 -d": false} {
+		matches, err := matcher(actual, "IEX")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if matches != expected {
+			t.Errorf("expected %s to match %t, got %t", actual, expected, matches)
+		}
+	}
+}
+
+func TestEncodingModifiersRequireBase64(t *testing.T) {
+	for _, modifier := range []string{"wide", "utf16le", "utf16be", "utf16"} {
+		t.Run(modifier, func(t *testing.T) {
+			comparator, err := GetComparator(modifier, "contains")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			_, err = comparator("CommandLine", "IEX")
+			if err == nil || !strings.Contains(err.Error(), "must be followed by base64") {
+				t.Errorf("expected the raw bytes to be rejected, got %v", err)
+			}
+
+			matcher, err := GetMatcher(modifier, "contains")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			_, err = matcher("powershell IEX", "IEX")
+			if err == nil || !strings.Contains(err.Error(), "must be followed by base64") {
+				t.Errorf("expected the raw bytes to be rejected by the matcher, got %v", err)
+			}
+		})
+	}
+}
+
+func TestWindashModifier(t *testing.T) {
+	comparator, err := GetComparator("windash", "contains")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A value with few flags is expanded into every variant of them
+	result, err := comparator("CommandLine", " -enc ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `(commandline="* -enc *" OR commandline="* /enc *" OR commandline="* –enc *" OR commandline="* —enc *" OR commandline="* ―enc *")`
+	if result != expected {
+		t.Errorf("expected %s, got %s", expected, result)
+	}
+
+	// A value with more flags is matched with a character class of the flag characters
+	result, err = comparator("CommandLine", " -a -b -c -d ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = `match(commandline, "(?i) [-/–—―]a [-/–—―]b [-/–—―]c [-/–—―]d ")`
+	if result != expected {
+		t.Errorf("expected %s, got %s", expected, result)
+	}
+}
+
+func TestWindashModifierLimit(t *testing.T) {
+	_, err := windash{}.Modify("-a -b -c -d -e -f")
+	if !errors.Is(err, ErrWindashLimit) {
+		t.Errorf("expected the expansion to be limited, got %v", err)
+	}
+
+	// Values that can't be matched with a regular expression fail with the limit error
+	comparator, err := GetComparator("windash", "base64")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := comparator("CommandLine", "-a -b -c -d"); !errors.Is(err, ErrWindashLimit) {
+		t.Errorf("expected the expansion to be limited, got %v", err)
+	}
+}
+
+func TestWindashModifierMatch(t *testing.T) {
+	matcher, err := GetMatcher("windash", "startswith")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for actual, expected := range map[string]bool{
+		"/A –b ―c -d x":  true,
+		"x -a -b -c -d":  false,
+		"-a -b -c +d":    false,
+		"-a -b -c -d*?x": true,
+	} {
+		matches, err := matcher(actual, "-a -b -c -d")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if matches != expected {
+			t.Errorf("expected %s to match %t, got %t", actual, expected, matches)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package evaluator
 
 import (
 	"github.com/mtnmunuklu/bridge/sigma"
+	"github.com/mtnmunuklu/bridge/sigma/evaluator/backends"
 )
 
 // Option is a function that takes a RuleEvaluator pointer and modifies its configuration
@@ -17,6 +18,14 @@ func WithPlaceholderExpander(f func(placeholderName string) ([]string, error)) O
 	}
 }
 
+// WithUnresolvedPlaceholders returns an Option that sets how the values of the expand modifier are handled if the placeholder
+// expander has no values for them. By default, the rule fails to evaluate.
+func WithUnresolvedPlaceholders(unresolved UnresolvedPlaceholders) Option {
+	return func(e *RuleEvaluator) {
+		e.unresolvedPlaceholders = unresolved
+	}
+}
+
 // WithConfig returns an Option that sets the provided Sigma configs to the RuleEvaluator.
 // The configs are used to initialize the RuleEvaluator, which creates field mappings and indexes for efficient evaluation of Sigma rules.
 // The configs should be provided in the order of precedence, and the function will append them to the RuleEvaluator's config slice.
@@ -35,3 +44,11 @@ func WithConfig(config ...sigma.Config) Option {
 func CaseSensitive(e *RuleEvaluator) {
 	e.caseSensitive = true
 }
+
+// WithBackend returns an Option that sets the backend used to render the Sigma rule into a query.
+// If no backend is provided, the rule is rendered as SPL.
+func WithBackend(backend backends.Backend) Option {
+	return func(e *RuleEvaluator) {
+		e.backend = backend
+	}
+}
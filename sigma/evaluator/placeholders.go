@@ -0,0 +1,183 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mtnmunuklu/bridge/sigma"
+	"github.com/mtnmunuklu/bridge/sigma/evaluator/backends"
+)
+
+// ErrUnresolvedPlaceholder is returned by placeholder expanders for placeholders that have no values.
+var ErrUnresolvedPlaceholder = errors.New("unresolved placeholder")
+
+// UnresolvedPlaceholders defines how the values of the expand modifier are handled if their placeholder has no values.
+type UnresolvedPlaceholders string
+
+const (
+	UnresolvedError    UnresolvedPlaceholders = "error"    // The rule fails to evaluate
+	UnresolvedSkip     UnresolvedPlaceholders = "skip"     // The value is left out, along with the field matcher if it has no other values
+	UnresolvedWildcard UnresolvedPlaceholders = "wildcard" // The value matches any value of the field
+)
+
+// ConfigPlaceholders returns the values of the placeholders defined by the configs, by the name of the placeholder without the surrounding %.
+// The values of a placeholder that is defined by several configs are combined.
+func ConfigPlaceholders(configs ...sigma.Config) map[string][]string {
+	placeholders := make(map[string][]string)
+	for _, config := range configs {
+		for name, values := range config.Placeholders {
+			name = strings.Trim(name, "%")
+			for _, value := range values {
+				placeholders[name] = append(placeholders[name], fmt.Sprint(value))
+			}
+		}
+	}
+	return placeholders
+}
+
+// PlaceholderExpander returns a placeholder expander that expands placeholders into the given values.
+// Placeholders that have no values are reported with ErrUnresolvedPlaceholder.
+func PlaceholderExpander(placeholders map[string][]string) func(placeholderName string) ([]string, error) {
+	return func(placeholderName string) ([]string, error) {
+		values, ok := placeholders[strings.Trim(placeholderName, "%")]
+		if !ok {
+			return nil, fmt.Errorf("%w %s", ErrUnresolvedPlaceholder, placeholderName)
+		}
+		return values, nil
+	}
+}
+
+// resolvePlaceholder expands the placeholder, handling placeholders that have no values as set by the evaluator.
+// The wildcard that replaces an unresolved placeholder depends on the comparator it is matched with.
+func (rule RuleEvaluator) resolvePlaceholder(placeholder string, comparator string) ([]string, error) {
+	if rule.expandPlaceholder == nil {
+		return nil, fmt.Errorf("can't expand %s, no placeholder expander function defined", placeholder)
+	}
+	values, err := rule.expandPlaceholder(placeholder)
+	if !errors.Is(err, ErrUnresolvedPlaceholder) {
+		return values, err
+	}
+
+	switch rule.unresolvedPlaceholders {
+	case UnresolvedSkip:
+		return nil, nil
+	case UnresolvedWildcard:
+		switch comparator {
+		case "", "contains", "startswith", "endswith":
+			return []string{"*"}, nil
+		case "re":
+			return []string{".*"}, nil
+		}
+		return nil, fmt.Errorf("%w, which can't be matched with a wildcard by the %s modifier", err, comparator)
+	}
+	return nil, err
+}
+
+// placeholderLookup returns the lookup table that the configs map the placeholder to, if the backend can match fields against lookup tables.
+func (rule RuleEvaluator) placeholderLookup(value any) (sigma.PlaceholderLookup, bool) {
+	if _, ok := rule.backend.(backends.LookupMatcher); !ok {
+		return sigma.PlaceholderLookup{}, false
+	}
+	placeholder, ok := value.(string)
+	if !ok || !strings.HasPrefix(placeholder, "%") || !strings.HasSuffix(placeholder, "%") {
+		return sigma.PlaceholderLookup{}, false
+	}
+	for _, config := range rule.config {
+		for name, lookup := range config.PlaceholderLookups {
+			if strings.Trim(name, "%") == strings.Trim(placeholder, "%") {
+				return lookup, true
+			}
+		}
+	}
+	return sigma.PlaceholderLookup{}, false
+}
+
+// splitLookups removes the placeholders that are mapped to lookup tables from the values of the field matcher,
+// and returns the lookup tables of the fields that the field is mapped to.
+func (rule RuleEvaluator) splitLookups(fieldMatcher sigma.FieldMatcher) (sigma.FieldMatcher, [][]backends.Lookup) {
+	if !slices.Contains(fieldMatcher.Modifiers, "expand") {
+		return fieldMatcher, nil
+	}
+
+	var values []any
+	var lookups [][]backends.Lookup
+	for _, value := range fieldMatcher.Values {
+		lookup, ok := rule.placeholderLookup(value)
+		if !ok {
+			values = append(values, value)
+			continue
+		}
+		var fieldLookups []backends.Lookup
+		for _, field := range rule.targetFields(fieldMatcher.Field) {
+			fieldLookups = append(fieldLookups, backends.Lookup{Field: field, PlaceholderLookup: lookup})
+		}
+		lookups = append(lookups, fieldLookups)
+	}
+	fieldMatcher.Values = values
+	return fieldMatcher, lookups
+}
+
+// lookups returns the lookup tables that the field matchers of the rule refer to.
+func (rule RuleEvaluator) lookups() []backends.Lookup {
+	var result []backends.Lookup
+	for _, search := range rule.Detection.Searches {
+		for _, eventMatcher := range search.EventMatchers {
+			for _, fieldMatcher := range eventMatcher {
+				_, lookups := rule.splitLookups(fieldMatcher)
+				for _, fieldLookups := range lookups {
+					result = append(result, fieldLookups...)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// evaluateLookups renders the matches of the field against the lookup tables of its placeholders,
+// combined with the matches of its remaining values.
+func (rule RuleEvaluator) evaluateLookups(fieldMatcher sigma.FieldMatcher, lookups [][]backends.Lookup, negated bool) (expression, error) {
+	allValuesMustMatch := len(fieldMatcher.Modifiers) > 0 && fieldMatcher.Modifiers[len(fieldMatcher.Modifiers)-1] == "all"
+	for _, modifier := range fieldMatcher.Modifiers {
+		if modifier != "expand" && modifier != "all" {
+			return expression{}, fmt.Errorf("field %s: placeholders that are lookups can't be combined with the %s modifier", fieldMatcher.Field, modifier)
+		}
+	}
+	if negated {
+		return expression{}, fmt.Errorf("field %s: placeholders that are lookups can't be negated by the backend", fieldMatcher.Field)
+	}
+
+	// Any of the fields that the field is mapped to can be found in the lookup table
+	var filters []expression
+	for _, fieldLookups := range lookups {
+		matches := make([]expression, len(fieldLookups))
+		for i, lookup := range fieldLookups {
+			query, err := rule.backend.(backends.LookupMatcher).LookupMatch(lookup)
+			if err != nil {
+				return expression{}, err
+			}
+			matches[i] = expression{query: query}
+		}
+		filter, err := rule.combine(rule.backend.Or, matches)
+		if err != nil {
+			return expression{}, err
+		}
+		filters = append(filters, filter)
+	}
+
+	if len(fieldMatcher.Values) > 0 {
+		filter, err := rule.evaluateFieldMatcher(fieldMatcher, negated)
+		if err != nil {
+			return expression{}, err
+		}
+		if filter.query != "" {
+			filters = append(filters, filter)
+		}
+	}
+
+	if allValuesMustMatch {
+		return rule.combine(rule.backend.And, filters)
+	}
+	return rule.combine(rule.backend.Or, filters)
+}
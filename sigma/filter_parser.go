@@ -0,0 +1,187 @@
+package sigma
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Filter is a Sigma filter, which adds exclusions to existing rules without modifying them
+type Filter struct {
+	// Required fields
+	Title     string          // The title of the filter
+	Logsource Logsource       // The log source of the rules that the filter applies to
+	Filter    FilterDetection // The rules that the filter applies to and its detection logic
+
+	// Optional fields
+	ID          string `yaml:",omitempty" json:",omitempty"` // The unique ID of the filter
+	Name        string `yaml:",omitempty" json:",omitempty"` // The name of the filter
+	Status      string `yaml:",omitempty" json:",omitempty"` // The status of the filter (e.g. "test", "stable")
+	Description string `yaml:",omitempty" json:",omitempty"` // A brief description of the filter
+	Author      string `yaml:",omitempty" json:",omitempty"` // The author of the filter
+
+	// Any non-standard fields will end up in here
+	AdditionalFields map[string]interface{} `yaml:",inline,omitempty" json:",inline,omitempty"` // Any additional fields in the YAML document
+}
+
+// FilterDetection holds the searches and condition of a filter, along with the rules it applies to
+type FilterDetection struct {
+	Rules     []string                        `yaml:",omitempty" json:",omitempty"` // The IDs or names of the rules that the filter applies to, all rules of the logsource if empty
+	Detection `yaml:",inline" json:",inline"` // The searches and condition of the filter, e.g. "not selection"
+}
+
+// UnmarshalYAML decodes the rules of the filter and passes the rest to the Detection unmarshaller
+func (f *FilterDetection) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("cannot unmarshal %d into FilterDetection", node.Kind)
+	}
+
+	detection := *node
+	detection.Content = nil
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "rules" {
+			if err := node.Content[i+1].Decode(&f.Rules); err != nil {
+				return err
+			}
+			continue
+		}
+		detection.Content = append(detection.Content, node.Content[i], node.Content[i+1])
+	}
+	return f.Detection.UnmarshalYAML(&detection)
+}
+
+// ParseFilter reads a byte slice and returns a parsed Filter object and an error (if any)
+func ParseFilter(input []byte) (Filter, error) {
+	filter := Filter{}
+	err := yaml.Unmarshal(input, &filter)
+	return filter, err
+}
+
+// AppliesTo reports whether the filter applies to the rule.
+// The rule must be listed in the filter by its ID or name, and its logsource must match the filter's logsource.
+func (filter Filter) AppliesTo(rule Rule) bool {
+	switch {
+	case filter.Logsource.Category != "" && filter.Logsource.Category != rule.Logsource.Category:
+		return false
+	case filter.Logsource.Product != "" && filter.Logsource.Product != rule.Logsource.Product:
+		return false
+	case filter.Logsource.Service != "" && filter.Logsource.Service != rule.Logsource.Service:
+		return false
+	case len(filter.Filter.Rules) == 0:
+		return true
+	}
+
+	for _, reference := range filter.Filter.Rules {
+		if reference == rule.ID || (rule.Name != "" && reference == rule.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns a copy of the rule with the filter's conditions ORed together and ANDed to each of its conditions.
+// The searches of the filter are added to the rule under a prefix, so that they can't clash with the rule's searches,
+// and the rule's "1 of them" and pattern conditions are expanded first, so that they don't pick up the filter's searches.
+func (filter Filter) Apply(rule Rule) Rule {
+	// Find a prefix that none of the rule's searches start with
+	prefix := "filter_"
+	for i := 2; hasSearchWithPrefix(rule.Detection.Searches, prefix); i++ {
+		prefix = fmt.Sprintf("filter%d_", i)
+	}
+
+	searches := make(map[string]Search, len(rule.Detection.Searches)+len(filter.Filter.Searches))
+	for name, search := range rule.Detection.Searches {
+		searches[name] = search
+	}
+	for name, search := range filter.Filter.Searches {
+		searches[prefix+name] = search
+	}
+
+	conditions := make(Conditions, len(rule.Detection.Conditions))
+	for i, condition := range rule.Detection.Conditions {
+		// A list of conditions matches if any of them matches, like the conditions of a rule
+		var filterConditions Or
+		for _, filterCondition := range filter.Filter.Conditions {
+			filterConditions = append(filterConditions, expandSearchExpr(filterCondition.Search, filter.Filter.Searches, prefix))
+		}
+		operands := And{expandSearchExpr(condition.Search, rule.Detection.Searches, "")}
+		switch len(filterConditions) {
+		case 0:
+		case 1:
+			operands = append(operands, filterConditions[0])
+		default:
+			operands = append(operands, filterConditions)
+		}
+		conditions[i] = Condition{node: condition.node, Search: operands, Aggregation: condition.Aggregation}
+	}
+
+	rule.Detection.Searches = searches
+	rule.Detection.Conditions = conditions
+	return rule
+}
+
+// hasSearchWithPrefix reports whether any of the searches' names starts with the prefix
+func hasSearchWithPrefix(searches map[string]Search, prefix string) bool {
+	for name := range searches {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandSearchExpr returns a copy of the search expression whose identifiers are prefixed,
+// with "1 of them", "all of them" and pattern conditions replaced by the searches they match
+func expandSearchExpr(search SearchExpr, searches map[string]Search, prefix string) SearchExpr {
+	switch s := search.(type) {
+	case And:
+		result := make(And, len(s))
+		for i, node := range s {
+			result[i] = expandSearchExpr(node, searches, prefix)
+		}
+		return result
+	case Or:
+		result := make(Or, len(s))
+		for i, node := range s {
+			result[i] = expandSearchExpr(node, searches, prefix)
+		}
+		return result
+	case Not:
+		return Not{Expr: expandSearchExpr(s.Expr, searches, prefix)}
+	case SearchIdentifier:
+		return SearchIdentifier{Name: prefix + s.Name}
+	case OneOfIdentifier:
+		return OneOfIdentifier{Ident: SearchIdentifier{Name: prefix + s.Ident.Name}}
+	case AllOfIdentifier:
+		return AllOfIdentifier{Ident: SearchIdentifier{Name: prefix + s.Ident.Name}}
+	case OneOfThem:
+		return Or(matchingSearchIdentifiers(searches, "*", prefix))
+	case AllOfThem:
+		return And(matchingSearchIdentifiers(searches, "*", prefix))
+	case OneOfPattern:
+		return Or(matchingSearchIdentifiers(searches, s.Pattern, prefix))
+	case AllOfPattern:
+		return And(matchingSearchIdentifiers(searches, s.Pattern, prefix))
+	}
+	return search
+}
+
+// matchingSearchIdentifiers returns the prefixed identifiers of the searches whose name matches the pattern, in a stable order
+func matchingSearchIdentifiers(searches map[string]Search, pattern string, prefix string) []SearchExpr {
+	var names []string
+	for name := range searches {
+		if matches, _ := path.Match(pattern, name); matches {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	identifiers := make([]SearchExpr, len(names))
+	for i, name := range names {
+		identifiers[i] = SearchIdentifier{Name: prefix + name}
+	}
+	return identifiers
+}
@@ -1,8 +1,9 @@
 package grammar
 
 type Condition struct {
-	Search      Disjunction  `@@`        // Represents the search condition
-	Aggregation *Aggregation `("|" @@)?` // Represents an optional aggregation function and its parameters
+	Search      Disjunction  `@@`              // Represents the search condition
+	Near        *Disjunction `("|" ("near" @@` // Represents an optional near condition that other events have to match
+	Aggregation *Aggregation `| @@))?`         // Represents an optional aggregation function and its parameters
 }
 
 type Disjunction struct {
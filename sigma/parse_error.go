@@ -0,0 +1,149 @@
+package sigma
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+)
+
+// ParseError is an error in the condition of a rule, with the position of the condition in the rule file
+// and the position of the offending token in the condition.
+type ParseError struct {
+	File       string // The name of the rule file, if known
+	Line       int    // The line of the condition in the YAML input, starting at 1 (0 if unknown)
+	Column     int    // The column of the condition in the YAML input, starting at 1 (0 if unknown)
+	Condition  string // The condition that failed to parse
+	Offset     int    // The byte offset of the offending token in the condition
+	Message    string // The description of the error
+	Suggestion string // A suggested fix, if the error is a common mistake
+}
+
+// Error renders the error with its position, a snippet of the condition with a caret under the offending token,
+// and the suggested fix (if any).
+func (e *ParseError) Error() string {
+	var builder strings.Builder
+	if e.File != "" {
+		builder.WriteString(e.File + ":")
+	}
+	if e.Line > 0 {
+		builder.WriteString(fmt.Sprintf("%d:%d:", e.Line, e.Column))
+	}
+	if builder.Len() > 0 {
+		builder.WriteString(" ")
+	}
+	builder.WriteString("error parsing condition: " + e.Message)
+
+	// The caret is indented by the characters before the offset, keeping tabs so that it lines up
+	builder.WriteString("\n    " + e.Condition + "\n    ")
+	for _, r := range e.Condition[:min(e.Offset, len(e.Condition))] {
+		if r == '\t' {
+			builder.WriteRune('\t')
+		} else {
+			builder.WriteRune(' ')
+		}
+	}
+	builder.WriteString("^")
+
+	if e.Suggestion != "" {
+		builder.WriteString("\n    " + e.Suggestion)
+	}
+	return builder.String()
+}
+
+// SetFile sets the file name of a ParseError in the error chain, so that it is included in the error message.
+// Other errors are returned unchanged.
+func SetFile(err error, file string) error {
+	var parseError *ParseError
+	if errors.As(err, &parseError) {
+		parseError.File = file
+	}
+	return err
+}
+
+// operatorKeywords are the keywords that join search expressions in a condition
+var operatorKeywords = []string{"and", "or", "not"}
+
+// identifierToken matches the tokens that name a search or a search pattern
+var identifierToken = regexp.MustCompile(`^[a-zA-Z_*][a-zA-Z0-9_*]*$`)
+
+// newParseError converts an error of the condition parser to a ParseError, with a suggested fix for common mistakes
+func newParseError(condition string, err error) *ParseError {
+	result := &ParseError{Condition: condition, Message: err.Error()}
+
+	var parserError participle.Error
+	if !errors.As(err, &parserError) {
+		return result
+	}
+	token := parserError.Token()
+	result.Offset, result.Message = token.Pos.Offset, parserError.Message()
+
+	value := strings.ToLower(token.Value)
+	switch {
+	case token.Type == lexer.EOF && strings.Count(condition, "(") > strings.Count(condition, ")"):
+		result.Suggestion = `add the missing ")"`
+	case token.Type == lexer.EOF:
+		result.Suggestion = "complete the condition"
+	case identifierToken.MatchString(token.Value):
+		for _, keyword := range operatorKeywords {
+			if value != keyword && editDistanceOne(value, keyword) {
+				result.Suggestion = fmt.Sprintf("did you mean %q?", keyword)
+				return result
+			}
+		}
+		if result.Offset > 0 {
+			result.Suggestion = fmt.Sprintf(`add "and" or "or" before %q`, token.Value)
+		}
+	}
+	return result
+}
+
+// undefinedOneOfError returns an error for a "1 of" or "all of" condition that refers to a search that doesn't exist,
+// if there are searches whose names start with it, which is a common mistake for "1 of selection*".
+func undefinedOneOfError(condition string, name string, searches map[string]Search) *ParseError {
+	for search := range searches {
+		if !strings.HasPrefix(search, name) {
+			continue
+		}
+
+		result := &ParseError{Condition: condition, Message: fmt.Sprintf("undefined search %s", name)}
+		match := regexp.MustCompile(`(?i)\bof\s+(` + regexp.QuoteMeta(name) + `)\b`).FindStringSubmatchIndex(condition)
+		if match != nil {
+			result.Offset = match[2]
+		}
+		result.Suggestion = fmt.Sprintf("did you mean %s* to match the searches starting with %s?", name, name)
+		return result
+	}
+	return nil
+}
+
+// editDistanceOne reports whether the strings differ by a single inserted, removed, replaced or swapped character
+func editDistanceOne(a, b string) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if len(b)-len(a) > 1 {
+		return false
+	}
+
+	// Skip the common prefix and suffix, at most one or two characters may remain
+	i := 0
+	for i < len(a) && a[i] == b[i] {
+		i++
+	}
+	j := 0
+	for j < len(a)-i && a[len(a)-1-j] == b[len(b)-1-j] {
+		j++
+	}
+	restA, restB := a[i:len(a)-j], b[i:len(b)-j]
+	switch {
+	case len(restA) <= 1 && len(restB) <= 1:
+		return true
+	case len(restA) == 2 && len(restB) == 2:
+		return restA[0] == restB[1] && restA[1] == restB[0]
+	}
+	return false
+}
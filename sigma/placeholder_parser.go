@@ -0,0 +1,65 @@
+package sigma
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ParsePlaceholders takes a byte slice of YAML data that maps placeholder names to a value or a list of values,
+// and returns the values by the name of the placeholder without the surrounding %.
+func ParsePlaceholders(contents []byte) (map[string][]string, error) {
+	var document map[string]yaml.Node
+	if err := yaml.Unmarshal(contents, &document); err != nil {
+		return nil, err
+	}
+
+	placeholders := make(map[string][]string, len(document))
+	for name, node := range document {
+		var values []string
+		switch node.Kind {
+		case yaml.ScalarNode:
+			values = []string{node.Value}
+		case yaml.SequenceNode:
+			if err := node.Decode(&values); err != nil {
+				return nil, fmt.Errorf("placeholder %s: %w", name, err)
+			}
+		default:
+			return nil, fmt.Errorf("placeholder %s must be a value or a list of values (line %d)", name, node.Line)
+		}
+		name = strings.Trim(name, "%")
+		placeholders[name] = append(placeholders[name], values...)
+	}
+	return placeholders, nil
+}
+
+// ParsePlaceholdersCSV takes a byte slice of CSV data, in which each record holds the name of a placeholder followed by its values,
+// and returns the values by the name of the placeholder without the surrounding %.
+// The values of records with the same placeholder name are combined.
+func ParsePlaceholdersCSV(contents []byte) (map[string][]string, error) {
+	reader := csv.NewReader(bytes.NewReader(contents))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	placeholders := make(map[string][]string)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 {
+			line, _ := reader.FieldPos(0)
+			return nil, fmt.Errorf("placeholder %s has no values (line %d)", record[0], line)
+		}
+		name := strings.Trim(record[0], "%")
+		placeholders[name] = append(placeholders[name], record[1:]...)
+	}
+	return placeholders, nil
+}
@@ -1,16 +1,35 @@
 package sigma
 
 import (
+	"bytes"
+	"errors"
+	"io"
+
 	"gopkg.in/yaml.v3"
 )
 
 // InferFileType attempts to infer the type of Sigma file by unmarshalling the YAML contents
 // and checking if it contains certain required fields for a rule or config file.
+// Files with several YAML documents are correlation rule files if any of the documents is a correlation rule,
+// otherwise their type is inferred from the first document.
 // If there is an error unmarshalling the contents, it returns an invalid file type.
 func InferFileType(contents []byte) FileType {
 	var fileType FileType
-	if err := yaml.Unmarshal(contents, &fileType); err != nil {
-		fileType = InvalidFile // If there is an error unmarshalling, assume the file is invalid
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	for i := 0; ; i++ {
+		var documentType FileType
+		if err := decoder.Decode(&documentType); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return InvalidFile // If there is an error unmarshalling, assume the file is invalid
+		}
+
+		if i == 0 || documentType == CorrelationFile {
+			fileType = documentType
+		}
+		if fileType == CorrelationFile {
+			break
+		}
 	}
 	return fileType
 }
@@ -24,6 +43,9 @@ const (
 	InvalidFile FileType = "invalid" // Invalid file type
 	RuleFile    FileType = "rule"    // Sigma rule file type
 	ConfigFile  FileType = "config"  // Sigma config file type
+
+	CorrelationFile FileType = "correlation" // Sigma correlation rule file type
+	FilterFile      FileType = "filter"      // Sigma filter file type
 )
 
 // UnmarshalYAML is a custom unmarshaller for the FileType type.
@@ -33,8 +55,16 @@ func (f *FileType) UnmarshalYAML(node *yaml.Node) error {
 	// Check if there's a key called "detection".
 	// This is a required field in a Sigma rule but doesn't exist in a config
 	for _, node := range node.Content {
-		if node.Kind == yaml.ScalarNode && node.Value == "detection" {
-			*f = RuleFile // If the node contains the "detection" key, assume it's a rule file
+		if node.Kind == yaml.ScalarNode && node.Value == "correlation" {
+			*f = CorrelationFile // If the node contains the "correlation" key, assume it's a correlation rule file
+			return nil
+		}
+		if node.Kind == yaml.ScalarNode && node.Value == "filter" {
+			*f = FilterFile // If the node contains the "filter" key, assume it's a filter file
+			return nil
+		}
+		if node.Kind == yaml.ScalarNode && (node.Value == "detection" || node.Value == "action") {
+			*f = RuleFile // If the node contains the "detection" key, or the "action" key of a rule collection, assume it's a rule file
 			return nil
 		}
 		if node.Kind == yaml.ScalarNode && node.Value == "logsources" {
@@ -1,7 +1,10 @@
 package sigma
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"strings"
 	"time"
 
@@ -9,6 +12,8 @@ import (
 )
 
 type Rule struct {
+	node *yaml.Node // The document of the rule
+
 	// Required fields
 	Title     string    // The title of the Sigma rule
 	Logsource Logsource // The log source that the rule should be applied to
@@ -16,6 +21,7 @@ type Rule struct {
 
 	// Optional fields
 	ID          string        `yaml:",omitempty" json:",omitempty"` // The unique ID of the rule
+	Name        string        `yaml:",omitempty" json:",omitempty"` // The name that correlation rules can refer to this rule by
 	Related     []RelatedRule `yaml:",omitempty" json:",omitempty"` // Related rules, if any
 	Status      string        `yaml:",omitempty" json:",omitempty"` // The status of the rule (e.g. "testing", "production")
 	Description string        `yaml:",omitempty" json:",omitempty"` // A brief description of the rule
@@ -28,6 +34,14 @@ type Rule struct {
 	AdditionalFields map[string]interface{} `yaml:",inline,omitempty" json:",inline,omitempty"` // Any additional fields in the YAML document
 }
 
+// Position returns the line and column of the document of this Rule in the original input, or -1 if it is unknown
+func (rule Rule) Position() (int, int) {
+	if rule.node == nil {
+		return -1, -1
+	}
+	return rule.node.Line - 1, rule.node.Column - 1
+}
+
 type RelatedRule struct {
 	ID   string // The unique ID of the related rule
 	Type string // The type of the related rule (e.g. "similar", "correlated", "superseded")
@@ -93,6 +107,53 @@ func (d *Detection) UnmarshalYAML(node *yaml.Node) error {
 	return nil
 }
 
+// checkOneOf returns a ParseError for a "1 of" or "all of" condition that refers to a search that doesn't exist.
+// "1 of selection" is a common mistake for "1 of selection*", which the parser can't tell apart from a valid condition.
+func (d Detection) checkOneOf() error {
+	for _, condition := range d.Conditions {
+		for _, name := range oneOfIdentifiers(condition.Search) {
+			if _, ok := d.Searches[name]; ok {
+				continue
+			}
+			if err := undefinedOneOfError(condition.node.Value, name, d.Searches); err != nil {
+				return withPosition(err, condition.node)
+			}
+		}
+	}
+	return nil
+}
+
+// oneOfIdentifiers returns the names of the searches that the "1 of" and "all of" expressions of the search refer to
+func oneOfIdentifiers(search SearchExpr) []string {
+	var names []string
+	switch s := search.(type) {
+	case And:
+		for _, node := range s {
+			names = append(names, oneOfIdentifiers(node)...)
+		}
+	case Or:
+		for _, node := range s {
+			names = append(names, oneOfIdentifiers(node)...)
+		}
+	case Not:
+		names = oneOfIdentifiers(s.Expr)
+	case OneOfIdentifier:
+		names = []string{s.Ident.Name}
+	case AllOfIdentifier:
+		names = []string{s.Ident.Name}
+	}
+	return names
+}
+
+// withPosition sets the position of the condition node on a ParseError. Other errors are returned unchanged.
+func withPosition(err error, node *yaml.Node) error {
+	var parseError *ParseError
+	if errors.As(err, &parseError) {
+		parseError.Line, parseError.Column = node.Line, node.Column
+	}
+	return err
+}
+
 type Conditions []Condition
 
 // UnmarshalYAML unmarshals the YAML node to the Conditions slice.
@@ -106,7 +167,7 @@ func (c *Conditions) UnmarshalYAML(node *yaml.Node) error {
 
 		parsed, err := ParseCondition(condition) // Parse the condition string into a Condition struct.
 		if err != nil {
-			return err
+			return withPosition(err, node)
 		}
 		parsed.node = node
 		*c = []Condition{parsed}
@@ -119,7 +180,7 @@ func (c *Conditions) UnmarshalYAML(node *yaml.Node) error {
 		for i, condition := range conditions {
 			parsed, err := ParseCondition(condition) // Parse each condition string in the slice into a Condition struct.
 			if err != nil {
-				return fmt.Errorf("error parsing condition \"%s\": %w", condition, err)
+				return withPosition(err, node.Content[i])
 			}
 			parsed.node = node.Content[i]
 			*c = append(*c, parsed) // Append the parsed Condition struct to the Conditions slice.
@@ -333,7 +394,138 @@ func ParseRule(input []byte) (Rule, error) {
 
 	// Unmarshal the input YAML data into the Rule instance
 	err := yaml.Unmarshal(input, &rule)
+	if err == nil {
+		err = rule.Detection.checkOneOf()
+	}
 
 	// Return the Rule instance and error (if any)
 	return rule, err
 }
+
+// ParseRules reads a byte slice of one or more YAML documents and returns the parsed Rule objects and an error (if any).
+// Rule collections are merged like the Sigma collection format does:
+// a document with "action: global" holds the fields that the following rules are merged into,
+// "action: reset" clears them, and "action: repeat" repeats the previous rule with the document's fields merged into it.
+// Correlation documents are skipped, see ParseCorrelations.
+// The conditions of the rules must only refer to searches that exist, see DecodeRules for rules that are not checked.
+func ParseRules(input []byte) ([]Rule, error) {
+	rules, err := DecodeRules(input)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		if err := rule.Detection.checkOneOf(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// DecodeRules reads the rules of the YAML documents like ParseRules does,
+// without checking that the conditions refer to searches that exist, so that all of the problems of a rule can be reported.
+func DecodeRules(input []byte) ([]Rule, error) {
+	var rules []Rule
+	var global, previous *yaml.Node
+
+	decoder := yaml.NewDecoder(bytes.NewReader(input))
+	for i := 1; ; i++ {
+		var document yaml.Node
+		if err := decoder.Decode(&document); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(document.Content) == 0 {
+			continue
+		}
+
+		content := document.Content[0]
+		if content.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("invalid rule (document %d, line %d). Expected a map", i, content.Line)
+		}
+		var fileType FileType
+		if err := content.Decode(&fileType); err == nil && fileType == CorrelationFile {
+			continue
+		}
+		action, content := removeAction(content)
+
+		var merged *yaml.Node
+		switch action {
+		case "global":
+			global = content
+			continue
+		case "reset":
+			global = nil
+			continue
+		case "repeat":
+			if previous == nil {
+				return nil, fmt.Errorf("action repeat (document %d) must follow a rule", i)
+			}
+			merged = mergeNodes(previous, content)
+		case "":
+			merged = mergeNodes(global, content)
+		default:
+			return nil, fmt.Errorf("unknown action %s (document %d)", action, i)
+		}
+
+		rule := Rule{}
+		if err := merged.Decode(&rule); err != nil {
+			// A ParseError is returned as is, as its message is rendered when the file name is set, and it has the line of the condition
+			var parseError *ParseError
+			if errors.As(err, &parseError) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("error parsing rule (document %d): %w", i, err)
+		}
+		rule.node = content
+		rules = append(rules, rule)
+		previous = merged
+	}
+	return rules, nil
+}
+
+// removeAction returns the action of a rule collection document, and a copy of the document without it
+func removeAction(node *yaml.Node) (string, *yaml.Node) {
+	var action string
+	result := *node
+	result.Content = nil
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "action" {
+			action = node.Content[i+1].Value
+			continue
+		}
+		result.Content = append(result.Content, node.Content[i], node.Content[i+1])
+	}
+	return action, &result
+}
+
+// mergeNodes returns a new mapping node with the keys of the override merged into the base.
+// Nested maps are merged recursively, any other value of the override replaces the value of the base.
+func mergeNodes(base *yaml.Node, override *yaml.Node) *yaml.Node {
+	if base == nil {
+		return override
+	}
+
+	result := *base
+	result.Content = append([]*yaml.Node{}, base.Content...)
+	for i := 0; i+1 < len(override.Content); i += 2 {
+		key, value := override.Content[i], override.Content[i+1]
+
+		replaced := false
+		for j := 0; j+1 < len(result.Content); j += 2 {
+			if result.Content[j].Value != key.Value {
+				continue
+			}
+			if result.Content[j+1].Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+				value = mergeNodes(result.Content[j+1], value)
+			}
+			result.Content[j+1] = value
+			replaced = true
+			break
+		}
+		if !replaced {
+			result.Content = append(result.Content, key, value)
+		}
+	}
+	return &result
+}